@@ -0,0 +1,439 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Entry is a key/value pair to be added via AddMulti.
+type Entry struct {
+	Key  interface{}
+	Data interface{}
+	// LifeSpan and MaxAge configure the expiration of the item, see
+	// ItemOptions.
+	LifeSpan time.Duration
+	MaxAge   time.Duration
+}
+
+// batchCall is a call of the batch data-loader, collecting keys until it gets
+// dispatched.
+type batchCall struct {
+	f     func(context.Context, []interface{}) (map[interface{}]*CacheItem, error)
+	keys  []interface{}
+	calls []*loadCall
+
+	// Context passed to the data-loader, cancelled once nobody waits for any
+	// of the keys anymore.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Number of calls somebody waits for, guarded by table.loadMutex.
+	pending int
+
+	// Dispatches the batch once the batch window passed.
+	timer Timer
+}
+
+// Result is the outcome of a batch operation for a single key.
+type Result struct {
+	Key  interface{}
+	Item *CacheItem
+	Err  error
+}
+
+// SetBatchDataLoader configures a data-loader callback, which ValueMulti uses
+// to load all keys missing from the table with a single call. Value uses it
+// as well, unless a single-key data-loader is configured, so concurrent
+// misses can be coalesced into a single call, see SetBatchWindow. It returns
+// the items it found, mapped by their keys. Keys missing from the map don't
+// exist, just like when a single-key data-loader returns nil. An error fails
+// the lookup of all keys passed to the call.
+// Without a batch data-loader, ValueMulti loads missing keys one by one via
+// the data-loader configured with SetDataLoader or SetDataLoaderContext.
+func (table *CacheTable) SetBatchDataLoader(f func(keys []interface{}) (map[interface{}]*CacheItem, error)) {
+	if f == nil {
+		table.SetBatchDataLoaderContext(nil)
+		return
+	}
+	table.SetBatchDataLoaderContext(func(ctx context.Context, keys []interface{}) (map[interface{}]*CacheItem, error) {
+		return f(keys)
+	})
+}
+
+// SetBatchDataLoaderContext configures a context-aware batch data-loader
+// callback, see SetBatchDataLoader. It receives a context carrying the values
+// of the one passed to ValueContext or ValueMultiContext by the caller who
+// started the batch, which gets cancelled once all callers gave up.
+func (table *CacheTable) SetBatchDataLoaderContext(f func(ctx context.Context, keys []interface{}) (map[interface{}]*CacheItem, error)) {
+	table.Lock()
+	defer table.Unlock()
+	table.loadBatch = f
+}
+
+// SetBatchWindow configures how the batch data-loader collects keys. Missing
+// keys get collected for up to maxWait after the first one, unless maxSize
+// keys got collected before, so concurrent misses share a single call of the
+// batch data-loader. A maxWait of 0, the default, calls the batch
+// data-loader right away with the keys missing from a single ValueMulti
+// call. A maxSize of 0 doesn't limit the size of the batches.
+func (table *CacheTable) SetBatchWindow(maxSize int, maxWait time.Duration) {
+	table.loadMutex.Lock()
+	defer table.loadMutex.Unlock()
+	table.batchSize = maxSize
+	table.batchWait = maxWait
+}
+
+// ValueMulti returns the items stored for keys, in the same order, and marks
+// them to be kept alive. It locks the table only once. Missing keys get
+// loaded by a single call of the batch data-loader, if configured.
+func (table *CacheTable) ValueMulti(keys ...interface{}) []Result {
+	return table.ValueMultiContext(context.Background(), keys...)
+}
+
+// ValueMultiContext is like ValueMulti, passing ctx on to the data-loader just
+// like ValueContext does.
+func (table *CacheTable) ValueMultiContext(ctx context.Context, keys ...interface{}) []Result {
+	results := make([]Result, len(keys))
+	var missing []int
+
+	table.RLock()
+	loadData := table.loadData
+	loadBatch := table.loadBatch
+	canLoad := loadData != nil || loadBatch != nil
+	policy := table.evictionPolicy
+	refreshAhead := table.refreshAhead
+	for i, key := range keys {
+		results[i].Key = key
+		if r, ok := table.items[key]; ok {
+			results[i].Item = r
+			continue
+		}
+		switch {
+		case !canLoad:
+			results[i].Err = ErrKeyNotFound
+		case table.isNegative(key):
+			// The data-loader recently couldn't find this key.
+			results[i].Err = ErrKeyNotFoundOrLoadable
+		default:
+			missing = append(missing, i)
+		}
+	}
+	table.RUnlock()
+
+	now := table.clock.Now()
+	for _, r := range results {
+		if r.Item == nil {
+			inc(&table.stats.misses)
+			continue
+		}
+		inc(&table.stats.hits)
+		if canLoad && (r.Item.IsStale() || (refreshAhead > 0 && r.Item.refreshDue(now, refreshAhead))) {
+			table.refresh(loadData, loadBatch, r.Item)
+		}
+		r.Item.KeepAlive()
+		if policy != nil {
+			policy.Accessed(r.Key)
+		}
+	}
+	if len(missing) == 0 {
+		return results
+	}
+
+	if loadBatch == nil {
+		// Load the keys one by one, but concurrently.
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var panicked interface{}
+		for _, i := range missing {
+			wg.Add(1)
+			go func(r *Result) {
+				defer wg.Done()
+				defer func() {
+					// Re-raise a data-loader panic in the calling goroutine.
+					if r := recover(); r != nil {
+						mu.Lock()
+						panicked = r
+						mu.Unlock()
+					}
+				}()
+				r.Item, r.Err = table.load(ctx, loadData, r.Key)
+			}(&results[i])
+		}
+		wg.Wait()
+		if panicked != nil {
+			panic(panicked)
+		}
+		return results
+	}
+
+	missingKeys := make([]interface{}, len(missing))
+	for j, i := range missing {
+		missingKeys[j] = keys[i]
+	}
+	for j, r := range table.loadMulti(ctx, loadBatch, missingKeys) {
+		results[missing[j]] = r
+	}
+	return results
+}
+
+// loadMulti fetches keys via the batch data-loader f and adds them to the
+// table. Keys already being loaded by another call are waited for, all others
+// get passed to a single call of f.
+func (table *CacheTable) loadMulti(ctx context.Context, f func(context.Context, []interface{}) (map[interface{}]*CacheItem, error), keys []interface{}) []Result {
+	results := make([]Result, len(keys))
+	if err := ctx.Err(); err != nil {
+		for i, key := range keys {
+			results[i] = Result{Key: key, Err: &LoadError{Key: key, Err: err}}
+		}
+		return results
+	}
+
+	table.loadMutex.Lock()
+	if table.loads == nil {
+		table.loads = make(map[interface{}]*loadCall)
+	}
+	calls := make([]*loadCall, len(keys))
+	for i, key := range keys {
+		c, ok := table.loads[key]
+		if !ok {
+			c = &loadCall{done: make(chan struct{})}
+			table.loads[key] = c
+			table.collect(ctx, f, key, c)
+		}
+		c.waiters++
+		calls[i] = c
+	}
+	if table.batch != nil && table.batchWait <= 0 {
+		table.dispatch(table.batch)
+	}
+	table.loadMutex.Unlock()
+
+	for i, key := range keys {
+		results[i].Key = key
+		results[i].Item, results[i].Err = table.wait(ctx, calls[i], key)
+	}
+	return results
+}
+
+// collect adds the call c loading key to the batch being collected, opening a
+// new one if needed. The batch gets dispatched once it's full, or at the
+// latest once the batch window passed.
+func (table *CacheTable) collect(ctx context.Context, f func(context.Context, []interface{}) (map[interface{}]*CacheItem, error), key interface{}, c *loadCall) {
+	// Careful: do not run this method unless table.loadMutex is locked!
+	b := table.batch
+	if b == nil {
+		// The batch carries the values of the context of the caller opening it.
+		b = &batchCall{f: f}
+		b.ctx, b.cancel = context.WithCancel(detachedContext{ctx})
+		if table.batchWait > 0 {
+			b.timer = table.clock.AfterFunc(table.batchWait, func() {
+				table.loadMutex.Lock()
+				defer table.loadMutex.Unlock()
+				if table.batch == b {
+					table.dispatch(b)
+				}
+			})
+		}
+		table.batch = b
+	}
+
+	b.keys = append(b.keys, key)
+	b.calls = append(b.calls, c)
+	b.pending++
+	c.cancel = func() {
+		// Only cancel the batch once nobody waits for any of its keys anymore.
+		b.pending--
+		if b.pending == 0 {
+			b.cancel()
+			if table.batch == b {
+				// Don't let later callers join a cancelled batch.
+				table.batch = nil
+				if b.timer != nil {
+					b.timer.Stop()
+				}
+			}
+		}
+	}
+	if table.batchSize > 0 && len(b.keys) >= table.batchSize {
+		table.dispatch(b)
+	}
+}
+
+// dispatch invokes the batch data-loader for batch b.
+func (table *CacheTable) dispatch(b *batchCall) {
+	// Careful: do not run this method unless table.loadMutex is locked!
+	table.batch = nil
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	go table.runLoadMulti(b.ctx, b.cancel, b.f, b.keys, b.calls)
+}
+
+// runLoadMulti invokes the batch data-loader f for the calls loading keys.
+func (table *CacheTable) runLoadMulti(ctx context.Context, cancel context.CancelFunc, f func(context.Context, []interface{}) (map[interface{}]*CacheItem, error), keys []interface{}, calls []*loadCall) {
+	defer cancel()
+	defer func() {
+		// Like runLoad, let the waiting goroutines panic instead.
+		if r := recover(); r != nil {
+			inc(&table.stats.loaderFailures)
+			p := &LoaderPanic{Value: r, Stack: debug.Stack()}
+			for _, c := range calls {
+				c.panicked = p
+			}
+			table.log("Batch data-loader panicked loading keys", keys, "for table", table.name, ":", r)
+		}
+
+		table.loadMutex.Lock()
+		for i, key := range keys {
+			if table.loads[key] == calls[i] {
+				delete(table.loads, key)
+			}
+		}
+		table.loadMutex.Unlock()
+		for _, c := range calls {
+			close(c.done)
+		}
+	}()
+
+	inc(&table.stats.loaderCalls)
+	start := time.Now()
+	items, err := f(ctx, keys)
+	table.stats.observeLoaderLatency(time.Since(start))
+	if err != nil {
+		inc(&table.stats.loaderFailures)
+	}
+
+	var entries []Entry
+	var found []*loadCall
+	for i, key := range keys {
+		c := calls[i]
+		item := items[key]
+		switch {
+		case err != nil:
+			c.err = &LoadError{Key: key, Err: err}
+		case item == nil:
+			c.err = ErrKeyNotFoundOrLoadable
+			table.addNegative(key)
+		default:
+			entries = append(entries, Entry{
+				Key:      key,
+				Data:     item.data,
+				LifeSpan: item.lifeSpan,
+				MaxAge:   item.maxAge,
+			})
+			found = append(found, c)
+		}
+	}
+	// Hand out loaded items to the waiters, even if they got evicted already.
+	added, _ := table.addMulti(entries)
+	for i, item := range added {
+		found[i].item = item
+	}
+}
+
+// AddMulti adds all entries to the cache, locking the table only once. It
+// returns the added items in the same order. Items which are no longer stored
+// once all entries got added are returned as nil, i.e. items evicted to make
+// room for later entries and items replaced by later entries for the same key.
+func (table *CacheTable) AddMulti(entries ...Entry) []*CacheItem {
+	_, stored := table.addMulti(entries)
+	return stored
+}
+
+// addMulti adds all entries to the cache. It returns all added items, as well
+// as the ones still stored with nil in place of the others.
+func (table *CacheTable) addMulti(entries []Entry) (items, stored []*CacheItem) {
+	items = make([]*CacheItem, len(entries))
+	for i, e := range entries {
+		items[i] = table.newItem(e.Key, e.Data, ItemOptions{LifeSpan: e.LifeSpan, MaxAge: e.MaxAge})
+	}
+
+	table.Lock()
+	replaced := make([]*CacheItem, 0, len(items))
+	var evicted []*CacheItem
+	for _, item := range items {
+		old, ok, e := table.insert(item)
+		if ok {
+			replaced = append(replaced, old)
+		}
+		evicted = append(evicted, e...)
+	}
+	stored = make([]*CacheItem, len(items))
+	for i, item := range items {
+		if table.items[item.key] == item {
+			stored[i] = item
+		}
+	}
+	expDur := table.cleanupInterval
+	addedItem := table.addedItem
+	aboutToDeleteItem := table.aboutToDeleteItem
+	removedItem := table.removedItem
+	table.Unlock()
+
+	notifyEvicted(aboutToDeleteItem, removedItem, evicted)
+	for _, old := range replaced {
+		notifyRemoved(removedItem, old, RemovalReplaced)
+	}
+	var next *CacheItem
+	for _, item := range items {
+		for _, callback := range addedItem {
+			callback(item)
+		}
+		if deadline := item.deadline(); !deadline.IsZero() && (next == nil || deadline.Before(next.deadline())) {
+			next = item
+		}
+	}
+	// Only the most imminent item may need an earlier expiration check.
+	if next != nil {
+		table.checkExpiration(next, expDur)
+	}
+	return items, stored
+}
+
+// DeleteMulti deletes the items stored for keys from the cache, locking the
+// table only once. It returns the deleted items in the same order, or
+// ErrKeyNotFound for missing keys. Unlike with Delete, the callbacks run once
+// all items got deleted.
+func (table *CacheTable) DeleteMulti(keys ...interface{}) []Result {
+	results := make([]Result, len(keys))
+
+	table.Lock()
+	for i, key := range keys {
+		results[i].Key = key
+		// Forget that the data-loader couldn't find the key, too.
+		if n, ok := table.negatives[key]; ok {
+			table.deleteNegative(n)
+		}
+		r, ok := table.items[key]
+		if !ok {
+			results[i].Err = ErrKeyNotFound
+			continue
+		}
+		table.log("Deleting item with key", key, "created on", r.createdOn, "and hit", r.AccessCount(), "times from table", table.name, "because it was", RemovalExplicit)
+		table.expirations.unschedule(r)
+		delete(table.items, key)
+		if table.evictionPolicy != nil {
+			table.evictionPolicy.Removed(key)
+		}
+		inc(&table.stats.deletes)
+		results[i].Item = r
+	}
+	aboutToDeleteItem := table.aboutToDeleteItem
+	removedItem := table.removedItem
+	table.Unlock()
+
+	for _, r := range results {
+		if r.Item != nil {
+			notifyDelete(aboutToDeleteItem, removedItem, r.Item, RemovalExplicit)
+		}
+	}
+	return results
+}
@@ -15,7 +15,7 @@ import (
 )
 
 func BenchmarkNotFoundAdd(b *testing.B) {
-	table := Cache("testNotFoundAdd")
+	table := NewTable("testNotFoundAdd")
 
 	var finish sync.WaitGroup
 	var added int32
@@ -47,3 +47,54 @@ func BenchmarkNotFoundAdd(b *testing.B) {
 	finish.Wait()
 
 }
+
+// cacheTable is the method set shared by CacheTable and ShardedTable.
+type cacheTable interface {
+	Add(key interface{}, lifeSpan time.Duration, data interface{}) *CacheItem
+	Value(key interface{}, args ...interface{}) (*CacheItem, error)
+}
+
+func benchmarkValue(b *testing.B, table cacheTable) {
+	for i := 0; i < 1024; i++ {
+		table.Add(i, 0, i)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			table.Value(i & 1023)
+			i++
+		}
+	})
+}
+
+func benchmarkAddValue(b *testing.B, table cacheTable) {
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if i%4 == 0 {
+				table.Add(i&1023, 0, i)
+			} else {
+				table.Value(i & 1023)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkCacheTableValue(b *testing.B) {
+	benchmarkValue(b, NewTable("benchmarkCacheTableValue"))
+}
+
+func BenchmarkShardedTableValue(b *testing.B) {
+	benchmarkValue(b, NewShardedTable("benchmarkShardedTableValue", 32))
+}
+
+func BenchmarkCacheTableAddValue(b *testing.B) {
+	benchmarkAddValue(b, NewTable("benchmarkCacheTableAddValue"))
+}
+
+func BenchmarkShardedTableAddValue(b *testing.B) {
+	benchmarkAddValue(b, NewShardedTable("benchmarkShardedTableAddValue", 32))
+}
@@ -8,38 +8,24 @@
 
 package cache2go
 
-import (
-	"sync"
-)
-
-var (
-	cache = make(map[string]*CacheTable)
-	mutex sync.RWMutex
-)
+// The registry holding the tables returned by Cache.
+var defaultRegistry = NewRegistry()
 
 // Cache returns the existing cache table with given name or creates a new one
-// if the table does not exist yet.
+// if the table does not exist yet. The options only get applied when creating
+// the table.
 // Cache函数，返回指定名字的表，如果表不存在则创建一个空表返回
-func Cache(table string) *CacheTable {
-	mutex.RLock()
-	// cache的类型，是一个用于存CacheTable的map
-	t, ok := cache[table]
-	mutex.RUnlock()
+func Cache(table string, opts ...TableOption) *CacheTable {
+	return defaultRegistry.Table(table, opts...)
+}
 
-	if !ok {
-		// 如果表不存在的时候需要创建一个空表，这时候同时做了一个读写锁和二次检查，为的是并发安全
-		mutex.Lock()
-		t, ok = cache[table]
-		// Double check whether the table exists or not.
-		if !ok {
-			t = &CacheTable{
-				name:  table,
-				items: make(map[interface{}]*CacheItem),
-			}
-			cache[table] = t
-		}
-		mutex.Unlock()
-	}
+// Tables returns all tables in the cache, sorted by name.
+func Tables() []*CacheTable {
+	return defaultRegistry.Tables()
+}
 
-	return t
+// Drop removes the table with the given name from the cache, see
+// Registry.Drop.
+func Drop(table string) bool {
+	return defaultRegistry.Drop(table)
 }
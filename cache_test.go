@@ -9,7 +9,11 @@ package cache2go
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"log"
+	"math"
+	"sort"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -54,38 +58,9 @@ func TestCache(t *testing.T) {
 	}
 }
 
-func TestCacheExpire(t *testing.T) {
-	table := Cache("testCache")
-
-	table.Add(k+"_1", 250*time.Millisecond, v+"_1")
-	table.Add(k+"_2", 200*time.Millisecond, v+"_2")
-
-	time.Sleep(100 * time.Millisecond)
-
-	// check key `1` is still alive
-	_, err := table.Value(k + "_1")
-	if err != nil {
-		t.Error("Error retrieving value from cache:", err)
-	}
-
-	time.Sleep(150 * time.Millisecond)
-
-	// check key `1` again, it should still be alive since we just accessed it
-	_, err = table.Value(k + "_1")
-	if err != nil {
-		t.Error("Error retrieving value from cache:", err)
-	}
-
-	// check key `2`, it should have been removed by now
-	_, err = table.Value(k + "_2")
-	if err == nil {
-		t.Error("Found key which should have been expired by now")
-	}
-}
-
 func TestExists(t *testing.T) {
 	// add an expiring item
-	table := Cache("testExists")
+	table := NewTable("testExists")
 	table.Add(k, 0, v)
 	// check if it exists
 	if !table.Exists(k) {
@@ -93,8 +68,34 @@ func TestExists(t *testing.T) {
 	}
 }
 
+func TestPeek(t *testing.T) {
+	table := NewTable("testPeek", WithMaxEntries(2))
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		return NewCacheItem(key, 0, v)
+	})
+	table.Add(1, 0, v)
+	table.Add(2, 0, v)
+
+	// peeking at an item doesn't save it from eviction
+	p, err := table.Peek(1)
+	if err != nil || p.Data().(string) != v || p.AccessCount() != 0 {
+		t.Error("Error peeking at item:", err)
+	}
+	table.Add(3, 0, v)
+	if table.Exists(1) {
+		t.Error("Error evicting item which was only peeked at")
+	}
+
+	if _, err := table.Peek(k); err != ErrKeyNotFound || table.Exists(k) {
+		t.Error("Error peeking at missing item:", err)
+	}
+	if s := table.Stats(); s.Hits != 0 || s.Misses != 0 {
+		t.Error("Error peeking without counting hits and misses:", s)
+	}
+}
+
 func TestNotFoundAdd(t *testing.T) {
-	table := Cache("testNotFoundAdd")
+	table := NewTable("testNotFoundAdd")
 
 	if !table.NotFoundAdd(k, 0, v) {
 		t.Error("Error verifying NotFoundAdd, data not in cache")
@@ -106,7 +107,7 @@ func TestNotFoundAdd(t *testing.T) {
 }
 
 func TestNotFoundAddConcurrency(t *testing.T) {
-	table := Cache("testNotFoundAdd")
+	table := NewTable("testNotFoundAdd")
 
 	var finish sync.WaitGroup
 	var added int32
@@ -146,31 +147,9 @@ func TestNotFoundAddConcurrency(t *testing.T) {
 	})
 }
 
-func TestCacheKeepAlive(t *testing.T) {
-	// add an expiring item
-	table := Cache("testKeepAlive")
-	p := table.Add(k, 250*time.Millisecond, v)
-
-	// keep it alive before it expires
-	time.Sleep(100 * time.Millisecond)
-	p.KeepAlive()
-
-	// check it's still alive after it was initially supposed to expire
-	time.Sleep(150 * time.Millisecond)
-	if !table.Exists(k) {
-		t.Error("Error keeping item alive")
-	}
-
-	// check it expires eventually
-	time.Sleep(300 * time.Millisecond)
-	if table.Exists(k) {
-		t.Error("Error expiring item after keeping it alive")
-	}
-}
-
 func TestDelete(t *testing.T) {
 	// add an item to the cache
-	table := Cache("testDelete")
+	table := NewTable("testDelete")
 	table.Add(k, 0, v)
 	// check it's really cached
 	p, err := table.Value(k)
@@ -194,7 +173,7 @@ func TestDelete(t *testing.T) {
 
 func TestFlush(t *testing.T) {
 	// add an item to the cache
-	table := Cache("testFlush")
+	table := NewTable("testFlush")
 	table.Add(k, 10*time.Second, v)
 	// flush the entire table
 	table.Flush()
@@ -212,7 +191,7 @@ func TestFlush(t *testing.T) {
 
 func TestCount(t *testing.T) {
 	// add a huge amount of items to the cache
-	table := Cache("testCount")
+	table := NewTable("testCount")
 	count := 100000
 	for i := 0; i < count; i++ {
 		key := k + strconv.Itoa(i)
@@ -234,7 +213,7 @@ func TestCount(t *testing.T) {
 
 func TestDataLoader(t *testing.T) {
 	// setup a cache with a configured data-loader
-	table := Cache("testDataLoader")
+	table := NewTable("testDataLoader")
 	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
 		var item *CacheItem
 		if key.(string) != "nil" {
@@ -263,10 +242,155 @@ func TestDataLoader(t *testing.T) {
 	}
 }
 
+func TestDataLoaderContext(t *testing.T) {
+	errBackend := errors.New("backend unavailable")
+
+	table := NewTable("testDataLoaderContext")
+	table.SetDataLoaderContext(func(ctx context.Context, key interface{}, args ...interface{}) (*CacheItem, error) {
+		switch key.(string) {
+		case "nil":
+			return nil, nil
+		case "fail":
+			return nil, errBackend
+		case "slow":
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Second):
+			}
+		}
+		return NewCacheItem(key, 0, k+key.(string)), nil
+	})
+
+	p, err := table.ValueContext(context.Background(), "1")
+	if err != nil || p.Data().(string) != k+"1" || !table.Exists("1") {
+		t.Error("Error validating context data loader", err)
+	}
+	_, err = table.Value("nil")
+	if err != ErrKeyNotFoundOrLoadable {
+		t.Error("Error validating context data loader for nil values", err)
+	}
+	_, err = table.Value("fail")
+	if !errors.Is(err, ErrKeyNotFoundOrLoadable) || !errors.Is(err, errBackend) {
+		t.Error("Error propagating context data loader error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = table.ValueContext(ctx, "slow")
+	if !errors.Is(err, ErrKeyNotFoundOrLoadable) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Error propagating context deadline", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("Error respecting context deadline")
+	}
+}
+
+func TestDataLoaderConcurrency(t *testing.T) {
+	var calls int32
+	table := NewTable("testDataLoaderConcurrency")
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return NewCacheItem(key, 0, v)
+	})
+
+	var finish sync.WaitGroup
+	var failed int32
+	for i := 0; i < 50; i++ {
+		finish.Add(1)
+		go func() {
+			defer finish.Done()
+			p, err := table.Value(k)
+			if err != nil || p.Data().(string) != v {
+				atomic.AddInt32(&failed, 1)
+			}
+		}()
+	}
+	finish.Wait()
+
+	if calls != 1 {
+		t.Error("Error coalescing concurrent data loader calls:", calls)
+	}
+	if failed != 0 {
+		t.Error("Error sharing data loader result with all callers:", failed)
+	}
+}
+
+func TestDataLoaderPanic(t *testing.T) {
+	table := NewTable("testDataLoaderPanic")
+	release := make(chan struct{})
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		<-release
+		panic("boom")
+	})
+
+	var finish sync.WaitGroup
+	var panicked int32
+	for i := 0; i < 5; i++ {
+		finish.Add(1)
+		go func() {
+			defer finish.Done()
+			defer func() {
+				if p, ok := recover().(*LoaderPanic); ok && p.Value == "boom" {
+					atomic.AddInt32(&panicked, 1)
+				}
+			}()
+			table.Value(k)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	finish.Wait()
+
+	if panicked != 5 {
+		t.Error("Error re-raising data loader panic in all callers:", panicked)
+	}
+	if table.Exists(k) {
+		t.Error("Error ignoring result of panicking data loader")
+	}
+}
+
+func TestNegativeCaching(t *testing.T) {
+	var calls int32
+	table := NewTable("testNegativeCaching")
+	table.SetNegativeLifeSpan(100 * time.Millisecond)
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := table.Value(k); err != ErrKeyNotFoundOrLoadable {
+			t.Error("Error retrieving negatively cached key", err)
+		}
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Error("Error caching missing key, data loader called", calls, "times")
+	}
+	if table.Exists(k) || table.Count() != 0 {
+		t.Error("Negatively cached key must not count as an item")
+	}
+
+	// the negative entry expires eventually
+	time.Sleep(150 * time.Millisecond)
+	table.Value(k)
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Error("Error expiring negatively cached key")
+	}
+
+	// adding the key replaces the negative entry
+	table.Add(k, 0, v)
+	if p, err := table.Value(k); err != nil || p.Data().(string) != v {
+		t.Error("Error adding negatively cached key", err)
+	}
+}
+
 func TestAccessCount(t *testing.T) {
 	// add 100 items to the cache
 	count := 100
-	table := Cache("testAccessCount")
+	table := NewTable("testAccessCount")
 	for i := 0; i < count; i++ {
 		table.Add(i, 10*time.Second, v)
 	}
@@ -303,7 +427,7 @@ func TestCallbacks(t *testing.T) {
 	calledExpired := false
 
 	// setup a cache with AddedItem & SetAboutToDelete handlers configured
-	table := Cache("testCallbacks")
+	table := NewTable("testCallbacks")
 	table.SetAddedItemCallback(func(item *CacheItem) {
 		m.Lock()
 		addedKey = item.Key().(string)
@@ -370,7 +494,7 @@ func TestCallbackQueue(t *testing.T) {
 	expired := false
 	calledExpired := false
 	// setup a cache with AddedItem & SetAboutToDelete handlers configured
-	table := Cache("testCallbacks")
+	table := NewTable("testCallbacks")
 
 	// test callback queue
 	table.AddAddedItemCallback(func(item *CacheItem) {
@@ -461,7 +585,7 @@ func TestLogger(t *testing.T) {
 	l := log.New(out, "cache2go ", log.Ldate|log.Ltime)
 
 	// setup a cache with this logger
-	table := Cache("testLogger")
+	table := NewTable("testLogger")
 	table.SetLogger(l)
 	table.Add(k, 0, v)
 
@@ -472,3 +596,933 @@ func TestLogger(t *testing.T) {
 		t.Error("Logger is empty")
 	}
 }
+
+func TestMaxEntries(t *testing.T) {
+	table := NewTable("testMaxEntries")
+	table.SetMaxEntries(3)
+
+	var evicted []interface{}
+	table.SetAboutToDeleteItemCallback(func(item *CacheItem) {
+		evicted = append(evicted, item.Key())
+		// evicted items are gone already, see SetAboutToDeleteItemCallback
+		if table.Exists(item.Key()) {
+			t.Error("Error running callback of evicted item after its removal")
+		}
+	})
+
+	table.Add(1, 0, v)
+	table.Add(2, 0, v)
+	table.Add(3, 0, v)
+	// touch the oldest item, so the LRU policy picks the second one
+	table.Value(1)
+	table.Add(4, 0, v)
+
+	if table.Count() != 3 {
+		t.Error("Error limiting table to max entries:", table.Count())
+	}
+	if len(evicted) != 1 || evicted[0] != 2 {
+		t.Error("Error evicting least recently used item:", evicted)
+	}
+	// replacing an existing item must not evict anything
+	table.Add(4, 0, v)
+	if len(evicted) != 1 {
+		t.Error("Error replacing item in full table:", evicted)
+	}
+}
+
+func TestMaxEntriesNotFoundAddConcurrency(t *testing.T) {
+	for round := 0; round < 50; round++ {
+		table := NewTable("testMaxEntriesNotFoundAddConcurrency", WithMaxEntries(1))
+		// slow callbacks widen the window for a racing NotFoundAdd
+		table.SetAboutToDeleteItemCallback(func(*CacheItem) {
+			time.Sleep(time.Millisecond)
+		})
+		table.Add("full", 0, v)
+
+		var finish sync.WaitGroup
+		var added int32
+		for i := 0; i < 8; i++ {
+			finish.Add(1)
+			go func() {
+				defer finish.Done()
+				if table.NotFoundAdd(k, 0, v) {
+					atomic.AddInt32(&added, 1)
+				}
+			}()
+		}
+		finish.Wait()
+
+		if added != 1 {
+			t.Fatal("Error adding key exactly once to full table:", added)
+		}
+	}
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy EvictionPolicy
+		victim int
+	}{
+		{"lru", NewLRUPolicy(), 2},
+		{"lfu", NewLFUPolicy(), 3},
+		{"fifo", NewFIFOPolicy(), 1},
+	}
+	for _, tt := range tests {
+		table := NewTable("testEvictionPolicies_" + tt.name)
+		table.SetEvictionPolicy(tt.policy)
+		table.SetMaxEntries(3)
+		table.Add(1, 0, v)
+		table.Add(2, 0, v)
+		table.Add(3, 0, v)
+		table.Value(2)
+		table.Value(2)
+		table.Value(1)
+		table.Value(1)
+		table.Value(3)
+		table.Add(4, 0, v)
+
+		if table.Exists(tt.victim) || table.Count() != 3 {
+			t.Error("Error evicting with", tt.name, "policy")
+		}
+	}
+
+	table := NewTable("testEvictionPolicies_random")
+	table.SetEvictionPolicy(NewRandomPolicy())
+	table.SetMaxEntries(10)
+	for i := 0; i < 100; i++ {
+		table.Add(i, 0, v)
+	}
+	if table.Count() != 10 || !table.Exists(99) {
+		t.Error("Error evicting with random policy")
+	}
+}
+
+func TestTypedTable(t *testing.T) {
+	type user struct {
+		name string
+	}
+	table := Typed[int, *user]("testTypedTable")
+
+	var deleted int
+	table.SetAboutToDeleteItemCallback(func(item *Item[int, *user]) {
+		deleted = item.Key()
+	})
+	table.SetDataLoader(func(key int, args ...interface{}) *Item[int, *user] {
+		if key < 0 {
+			return nil
+		}
+		return NewItem(key, 0, &user{"loaded" + strconv.Itoa(key)})
+	})
+
+	table.Add(1, 0, &user{"one"})
+	p, err := table.Value(1)
+	if err != nil || p.Key() != 1 || p.Data().name != "one" {
+		t.Error("Error retrieving typed data from cache", err)
+	}
+	p, err = table.Value(2)
+	if err != nil || p.Data().name != "loaded2" {
+		t.Error("Error validating typed data loader", err)
+	}
+	if _, err = table.Value(-1); err != ErrKeyNotFoundOrLoadable {
+		t.Error("Error validating typed data loader for nil values", err)
+	}
+
+	// the untyped API operates on the very same items
+	if item, err := table.Table().Value(1); err != nil || item.Data().(*user).name != "one" {
+		t.Error("Error retrieving typed data via untyped table", err)
+	}
+
+	table.Delete(1)
+	if deleted != 1 || table.Exists(1) {
+		t.Error("Error deleting typed data")
+	}
+}
+
+func TestShardedTable(t *testing.T) {
+	table := NewShardedTable("testShardedTable", 5)
+	if len(table.shards) != 8 {
+		t.Error("Error rounding shard count to power of two:", len(table.shards))
+	}
+
+	count := 1000
+	for i := 0; i < count; i++ {
+		table.Add(i, 0, i)
+		table.Add(k+strconv.Itoa(i), 0, v)
+	}
+	if table.Count() != 2*count {
+		t.Error("Data count mismatch")
+	}
+	for i, shard := range table.shards {
+		if shard.Count() == 0 {
+			t.Error("Error spreading keys across shards, shard is empty:", i)
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		p, err := table.Value(i)
+		if err != nil || p.Data().(int) != i {
+			t.Error("Error retrieving data from sharded table", err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		table.Value(i)
+	}
+	if ma := table.MostAccessed(10); len(ma) != 10 || ma[0].AccessCount() != 2 {
+		t.Error("Error retrieving most accessed items from sharded table")
+	}
+
+	// keys equal as map keys end up in the same shard
+	negZero := math.Copysign(0, -1)
+	table.Add(0.0, 0, v)
+	if !table.Exists(negZero) || table.shard(0.0) != table.shard(negZero) {
+		t.Error("Error finding float key 0 via -0 in sharded table")
+	}
+	table.Delete(negZero)
+	type point struct {
+		x, y float64
+		tag  interface{}
+	}
+	table.Add(point{0, 1, "a"}, 0, v)
+	if !table.Exists(point{negZero, 1, "a"}) {
+		t.Error("Error finding struct key via equal struct in sharded table")
+	}
+	table.Delete(point{0, 1, "a"})
+	// pointers are keys by their address, not by what they point to
+	for i := 0; i < 100; i++ {
+		p := &point{x: float64(i)}
+		table.Add(p, 0, v)
+		p.x = -1
+		if !table.Exists(p) {
+			t.Error("Error finding pointer key after changing its data in sharded table")
+		}
+		table.Delete(p)
+	}
+
+	table.Delete(0)
+	if table.Exists(0) || table.Count() != 2*count-1 {
+		t.Error("Error deleting data from sharded table")
+	}
+	table.Flush()
+	if table.Count() != 0 {
+		t.Error("Error flushing sharded table")
+	}
+}
+
+func TestExpirationHeap(t *testing.T) {
+	table := NewTable("testExpirationHeap")
+	count := 1000
+	for i := 0; i < count; i++ {
+		table.Add(i, time.Duration(10+i%90)*time.Millisecond, v)
+		table.Add(k+strconv.Itoa(i), 0, v)
+	}
+	// keep an item alive past its initial deadline
+	p := table.Add(k, 150*time.Millisecond, v)
+	time.Sleep(100 * time.Millisecond)
+	p.KeepAlive()
+
+	time.Sleep(100 * time.Millisecond)
+	if table.Count() != count+1 || !table.Exists(k) {
+		t.Error("Error expiring items via expiration heap:", table.Count())
+	}
+	table.RLock()
+	if len(table.expirations) != 1 {
+		t.Error("Error unscheduling expired items:", len(table.expirations))
+	}
+	table.RUnlock()
+}
+
+func TestSnapshot(t *testing.T) {
+	table := NewTable("testSnapshot")
+	table.Add(k, 0, v)
+	table.Add(1, 10*time.Second, 42)
+	p := table.Add(k+"_expiring", 150*time.Millisecond, v)
+	table.Value(k)
+	table.Value(k)
+
+	buf := new(bytes.Buffer)
+	if err := table.SaveTo(buf); err != nil {
+		t.Fatal("Error saving snapshot:", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	restored := NewTable("testSnapshotRestored")
+	if err := restored.LoadFrom(buf); err != nil {
+		t.Fatal("Error loading snapshot:", err)
+	}
+	if restored.Count() != 3 {
+		t.Error("Data count mismatch after loading snapshot:", restored.Count())
+	}
+	r, err := restored.Value(k)
+	if err != nil || r.Data().(string) != v || r.AccessCount() != 3 {
+		t.Error("Error restoring item from snapshot", err)
+	}
+	r, err = restored.Value(1)
+	if err != nil || r.Data().(int) != 42 || r.LifeSpan() != 10*time.Second {
+		t.Error("Error restoring item from snapshot", err)
+	}
+
+	// the expiring item keeps its remaining lifetime instead of a new one
+	r, _ = restored.Value(k + "_expiring")
+	if !r.CreatedOn().Equal(p.CreatedOn()) {
+		t.Error("Error restoring creation time from snapshot")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if restored.Exists(k + "_expiring") {
+		t.Error("Error restoring remaining lifetime from snapshot")
+	}
+
+	// files can be loaded into sharded tables as well
+	path := t.TempDir() + "/snapshot"
+	if err := table.SaveFile(path); err != nil {
+		t.Fatal("Error saving snapshot file:", err)
+	}
+	sharded := NewShardedTable("testSnapshotSharded", 4)
+	if err := sharded.LoadFile(path); err != nil {
+		t.Fatal("Error loading snapshot file:", err)
+	}
+	if !sharded.Exists(k) || !sharded.Exists(1) {
+		t.Error("Error loading snapshot file into sharded table")
+	}
+}
+
+func TestStats(t *testing.T) {
+	table := NewTable("testStats")
+	table.SetMaxEntries(2)
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		if key == "nil" {
+			return nil
+		}
+		return NewCacheItem(key, 0, v)
+	})
+
+	table.Add(1, 0, v)
+	table.Add(1, 0, v)
+	table.Add(2, 50*time.Millisecond, v)
+	table.Value(1)
+	table.Value("nil")
+	table.Value(3)
+	table.Delete(3)
+	table.Add(2, 50*time.Millisecond, v)
+	time.Sleep(100 * time.Millisecond)
+	table.Flush()
+
+	s := table.Stats()
+	expected := TableStats{
+		Hits:           1,
+		Misses:         2,
+		LoaderCalls:    2,
+		LoaderFailures: 1,
+		Adds:           4,
+		Replaces:       1,
+		Deletes:        1,
+		Expirations:    1,
+		Evictions:      1,
+		Flushes:        1,
+	}
+	if s != expected {
+		t.Errorf("Error counting table stats: %+v", s)
+	}
+	if s.HitRatio() != 1.0/3 {
+		t.Error("Error calculating hit ratio:", s.HitRatio())
+	}
+
+	table.ResetStats()
+	if table.Stats() != (TableStats{}) {
+		t.Error("Error resetting table stats")
+	}
+}
+
+func TestRemovalReasons(t *testing.T) {
+	var m sync.Mutex
+	removed := make(map[string][]RemovalReason)
+	itemRemoved := false
+
+	table := NewTable("testRemovalReasons")
+	table.SetMaxEntries(2)
+	table.SetRemovedItemCallback(func(item *CacheItem, reason RemovalReason) {
+		m.Lock()
+		removed[item.Key().(string)] = append(removed[item.Key().(string)], reason)
+		m.Unlock()
+	})
+
+	table.Add("a", 0, v).SetRemovedCallback(func(key interface{}, reason RemovalReason) {
+		m.Lock()
+		itemRemoved = reason == RemovalReplaced
+		m.Unlock()
+	})
+	table.Add("a", 0, v)
+	table.Delete("a")
+
+	table.Add("e", 50*time.Millisecond, v)
+	time.Sleep(100 * time.Millisecond)
+
+	table.Add("x", 0, v)
+	table.Add("y", 0, v)
+	table.Value("x")
+	table.Add("z", 0, v)
+	table.Flush()
+
+	m.Lock()
+	defer m.Unlock()
+	expected := map[string][]RemovalReason{
+		"a": {RemovalReplaced, RemovalExplicit},
+		"e": {RemovalExpired},
+		"y": {RemovalEvicted},
+		"x": {RemovalFlushed},
+		"z": {RemovalFlushed},
+	}
+	for key, reasons := range expected {
+		if len(removed[key]) != len(reasons) {
+			t.Error("Error reporting removal of", key, removed[key])
+			continue
+		}
+		for i, reason := range reasons {
+			if removed[key][i] != reason {
+				t.Error("Error reporting removal reason of", key, removed[key][i], "instead of", reason)
+			}
+		}
+	}
+	if !itemRemoved {
+		t.Error("Error reporting removal of replaced item to item callback")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	opted := false
+	table := r.Table("testRegistry", func(table *CacheTable) {
+		opted = true
+	})
+	if !opted {
+		t.Error("Error applying option to new table")
+	}
+	opted = false
+	if r.Table("testRegistry", func(table *CacheTable) { opted = true }) != table || opted {
+		t.Error("Error returning existing table without applying options")
+	}
+	if Cache("testRegistry") == table {
+		t.Error("Error keeping registries apart")
+	}
+
+	r.Table("testRegistry2")
+	if tables := r.Tables(); len(tables) != 2 || tables[0] != table {
+		t.Error("Error listing tables of registry:", tables)
+	}
+
+	expired := make(chan bool, 1)
+	table.SetAboutToDeleteItemCallback(func(*CacheItem) {
+		expired <- true
+	})
+	table.Add(k, 50*time.Millisecond, v)
+	if !r.Drop("testRegistry") || r.Drop("testRegistry") {
+		t.Error("Error dropping table")
+	}
+	select {
+	case <-expired:
+		t.Error("Dropped table still expired items")
+	case <-time.After(150 * time.Millisecond):
+	}
+	if r.Table("testRegistry") == table {
+		t.Error("Error creating new table after drop")
+	}
+
+	r.Close()
+	if len(r.Tables()) != 0 {
+		t.Error("Error dropping all tables on close")
+	}
+}
+
+func TestTableOptions(t *testing.T) {
+	var m sync.Mutex
+	var added, removed int
+	table := NewTable("testTableOptions",
+		WithLoader(func(key interface{}, args ...interface{}) *CacheItem {
+			return NewCacheItem(key, DefaultLifeSpan, "loaded")
+		}),
+		WithMaxEntries(2),
+		WithEvictionPolicy(NewFIFOPolicy()),
+		WithDefaultLifeSpan(50*time.Millisecond),
+		WithAddedItemCallback(func(*CacheItem) {
+			m.Lock()
+			added++
+			m.Unlock()
+		}),
+		WithRemovedItemCallback(func(*CacheItem, RemovalReason) {
+			m.Lock()
+			removed++
+			m.Unlock()
+		}),
+	)
+	if Cache("testTableOptions") == table {
+		t.Error("Error keeping table created by NewTable private")
+	}
+
+	item := table.Add("a", DefaultLifeSpan, v)
+	if item.LifeSpan() != 50*time.Millisecond {
+		t.Error("Error applying default lifespan:", item.LifeSpan())
+	}
+	if item, err := table.Value("b"); err != nil || item.Data() != "loaded" || item.LifeSpan() != 50*time.Millisecond {
+		t.Error("Error loading item with default lifespan:", err)
+	}
+	table.Value("a")
+	table.Add("c", 0, v)
+	if table.Exists("a") || !table.Exists("b") {
+		t.Error("Error evicting via configured policy")
+	}
+	m.Lock()
+	if added != 3 || removed != 1 {
+		t.Error("Error calling configured callbacks:", added, removed)
+	}
+	m.Unlock()
+
+	time.Sleep(100 * time.Millisecond)
+	if table.Exists("b") || !table.Exists("c") {
+		t.Error("Error expiring item with default lifespan")
+	}
+
+	// Options only apply to new tables.
+	table = Cache("testTableOptionsCache", WithMaxEntries(1))
+	if Cache("testTableOptionsCache", WithMaxEntries(2)) != table {
+		t.Error("Error returning existing table")
+	}
+	table.Add("a", 0, v)
+	table.Add("b", 0, v)
+	if table.Count() != 1 {
+		t.Error("Error applying options when creating table via Cache")
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	table := NewTable("testCompareAndSwap")
+	a := table.Add(k, 0, "a")
+	b := table.Add(k+"_other", 0, "b")
+	if a.Version() == 0 || b.Version() <= a.Version() {
+		t.Error("Error assigning increasing versions:", a.Version(), b.Version())
+	}
+
+	c, err := table.CompareAndSwap(k, a.Version(), 0, "c")
+	if err != nil || c.Data() != "c" || c.Version() <= b.Version() {
+		t.Error("Error swapping item with matching version:", err)
+	}
+	if _, err := table.CompareAndSwap(k, a.Version(), 0, "d"); err != ErrVersionMismatch {
+		t.Error("Expected version mismatch swapping stale item, got", err)
+	}
+	if _, err := table.CompareAndSwap("missing", a.Version(), 0, "d"); err != ErrKeyNotFound {
+		t.Error("Expected missing key swapping unknown item, got", err)
+	}
+	if p, _ := table.Value(k); p.Data() != "c" {
+		t.Error("Error keeping item after failed swap:", p.Data())
+	}
+
+	if _, err := table.CompareAndDelete(k, a.Version()); err != ErrVersionMismatch {
+		t.Error("Expected version mismatch deleting stale item, got", err)
+	}
+	if _, err := table.CompareAndDelete(k, c.Version()); err != nil || table.Exists(k) {
+		t.Error("Error deleting item with matching version:", err)
+	}
+
+	// concurrent read-modify-write cycles must not lose any update
+	table.Add("counter", 0, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for {
+					p, _ := table.Value("counter")
+					if _, err := table.CompareAndSwap("counter", p.Version(), 0, p.Data().(int)+1); err == nil {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if p, _ := table.Value("counter"); p.Data() != 1000 {
+		t.Error("Error serializing updates via CompareAndSwap:", p.Data())
+	}
+}
+
+func TestCompute(t *testing.T) {
+	table := NewTable("testCompute")
+	var m sync.Mutex
+	var added, deleted int
+	table.SetAddedItemCallback(func(*CacheItem) {
+		m.Lock()
+		added++
+		m.Unlock()
+	})
+	table.SetAboutToDeleteItemCallback(func(*CacheItem) {
+		m.Lock()
+		deleted++
+		m.Unlock()
+	})
+
+	increment := func(old *CacheItem, exists bool) (interface{}, time.Duration, bool) {
+		if !exists {
+			return 1, 0, true
+		}
+		return old.Data().(int) + 1, 0, true
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				table.Compute("counter", increment)
+			}
+		}()
+	}
+	wg.Wait()
+	if p, err := table.Value("counter"); err != nil || p.Data() != 1000 {
+		t.Error("Error serializing updates via Compute:", err)
+	}
+
+	p := table.Compute("counter", func(old *CacheItem, exists bool) (interface{}, time.Duration, bool) {
+		return nil, 0, false
+	})
+	if p != nil || table.Exists("counter") {
+		t.Error("Error deleting item via Compute")
+	}
+
+	calls := 0
+	absent := func() (interface{}, time.Duration, bool) {
+		calls++
+		return v, time.Second, true
+	}
+	p = table.ComputeIfAbsent(k, absent)
+	if p == nil || p.Data() != v || p.LifeSpan() != time.Second {
+		t.Error("Error adding item via ComputeIfAbsent")
+	}
+	if table.ComputeIfAbsent(k, absent) != p || calls != 1 {
+		t.Error("Error returning existing item from ComputeIfAbsent")
+	}
+
+	present := func(old *CacheItem) (interface{}, time.Duration, bool) {
+		return old.Data().(string) + "!", old.LifeSpan(), true
+	}
+	if table.ComputeIfPresent("missing", present) != nil || table.Exists("missing") {
+		t.Error("Error skipping missing item in ComputeIfPresent")
+	}
+	if p := table.ComputeIfPresent(k, present); p == nil || p.Data() != v+"!" {
+		t.Error("Error updating item via ComputeIfPresent")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if added != 1002 || deleted != 1 {
+		t.Error("Error calling callbacks for computed items:", added, deleted)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	table := NewTable("testCounters")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				table.Increment("hits", 2, 0)
+				table.Decrement("hits", 1, 0)
+			}
+		}()
+	}
+	wg.Wait()
+	if n, err := table.Increment("hits", 0, 0); err != nil || n != 1000 {
+		t.Error("Error counting atomically:", n, err)
+	}
+
+	table.Add("small", 0, uint8(5))
+	if n, err := table.Increment("small", 300, 0); err != nil || n != 305 {
+		t.Error("Error incrementing counter of another integer type:", n, err)
+	}
+
+	if f, err := table.IncrementFloat("temp", 1.5, time.Second); err != nil || f != 1.5 {
+		t.Error("Error creating float counter:", f, err)
+	}
+	if f, err := table.DecrementFloat("temp", 0.25, time.Second); err != nil || f != 1.25 {
+		t.Error("Error decrementing float counter:", f, err)
+	}
+	if f, err := table.IncrementFloat("small", 0.5, 0); err != nil || f != 305.5 {
+		t.Error("Error incrementing integer counter as float:", f, err)
+	}
+	if p, _ := table.Value("temp"); p.LifeSpan() != time.Second {
+		t.Error("Error setting lifespan of counter")
+	}
+
+	// counters get updated in place, without triggering callbacks
+	var callbacks int
+	table.SetAddedItemCallback(func(item *CacheItem) {
+		callbacks++
+	})
+	table.SetRemovedItemCallback(func(item *CacheItem, reason RemovalReason) {
+		callbacks++
+	})
+	p, _ := table.Peek("hits")
+	version, replaces := p.Version(), table.Stats().Replaces
+	if n, err := table.Increment("hits", 1, 0); err != nil || n != 1001 || p.Data() != int64(1001) {
+		t.Error("Error updating counter in place:", n, err)
+	}
+	if p.Version() <= version || callbacks != 0 || table.Stats().Replaces != replaces {
+		t.Error("Error updating counter without side effects:", p.Version(), callbacks, table.Stats())
+	}
+	table.RemoveAddedItemCallbacks()
+	table.RemoveRemovedItemCallbacks()
+
+	table.Add(k, 0, v)
+	_, err := table.Increment(k, 1, 0)
+	var nerr *NotNumericError
+	if !errors.Is(err, ErrNotNumeric) || !errors.As(err, &nerr) || nerr.Data != v {
+		t.Error("Expected NotNumericError incrementing string, got", err)
+	}
+	if _, err := table.Increment("temp", 1, 0); !errors.Is(err, ErrNotNumeric) {
+		t.Error("Expected NotNumericError incrementing float as integer, got", err)
+	}
+	if p, _ := table.Value(k); p.Data() != v {
+		t.Error("Error keeping non-numeric item")
+	}
+}
+
+func TestBatchOperations(t *testing.T) {
+	for _, table := range []interface {
+		AddMulti(entries ...Entry) []*CacheItem
+		ValueMulti(keys ...interface{}) []Result
+		DeleteMulti(keys ...interface{}) []Result
+		SetBatchDataLoaderContext(f func(ctx context.Context, keys []interface{}) (map[interface{}]*CacheItem, error))
+		Count() int
+	}{
+		NewTable("testBatchOperations"),
+		NewShardedTable("testBatchOperationsSharded", 4),
+	} {
+		items := table.AddMulti(
+			Entry{Key: "a", Data: 1},
+			Entry{Key: "b", Data: 2, LifeSpan: time.Minute},
+			Entry{Key: "c", Data: 3},
+		)
+		if len(items) != 3 || items[1].Key() != "b" || items[1].LifeSpan() != time.Minute || table.Count() != 3 {
+			t.Error("Error adding items via AddMulti")
+		}
+
+		results := table.ValueMulti("a", "missing", "c")
+		if len(results) != 3 || results[0].Item.Data() != 1 || results[2].Item.Data() != 3 || results[1].Key != "missing" || results[1].Err != ErrKeyNotFound {
+			t.Error("Error getting items via ValueMulti:", results)
+		}
+
+		var m sync.Mutex
+		var calls [][]interface{}
+		table.SetBatchDataLoaderContext(func(ctx context.Context, keys []interface{}) (map[interface{}]*CacheItem, error) {
+			m.Lock()
+			calls = append(calls, keys)
+			m.Unlock()
+			items := make(map[interface{}]*CacheItem)
+			for _, key := range keys {
+				if key.(string) != "unknown" {
+					items[key] = NewCacheItem(key, 0, "loaded "+key.(string))
+				}
+			}
+			return items, nil
+		})
+		results = table.ValueMulti("a", "x", "y", "unknown")
+		if results[0].Item.Data() != 1 || results[1].Item.Data() != "loaded x" || results[2].Item.Data() != "loaded y" || results[3].Err != ErrKeyNotFoundOrLoadable {
+			t.Error("Error loading missing items via ValueMulti:", results)
+		}
+		loaded := 0
+		for _, keys := range calls {
+			loaded += len(keys)
+		}
+		if loaded != 3 {
+			t.Error("Error passing only missing keys to batch data-loader:", calls)
+		}
+		if _, err := table.(interface {
+			Value(key interface{}, args ...interface{}) (*CacheItem, error)
+		}).Value("z"); err != nil {
+			t.Error("Error loading single item via batch data-loader:", err)
+		}
+
+		results = table.DeleteMulti("a", "missing", "x")
+		if results[0].Item.Data() != 1 || results[1].Err != ErrKeyNotFound || results[2].Item.Data() != "loaded x" {
+			t.Error("Error deleting items via DeleteMulti:", results)
+		}
+		if table.Count() != 4 {
+			t.Error("Error counting items after DeleteMulti:", table.Count())
+		}
+	}
+}
+
+func TestAddMultiEviction(t *testing.T) {
+	table := NewTable("testAddMultiEviction", WithMaxEntries(2))
+	var evicted []interface{}
+	table.SetRemovedItemCallback(func(item *CacheItem, reason RemovalReason) {
+		if reason == RemovalEvicted {
+			evicted = append(evicted, item.Key())
+		}
+	})
+
+	// only the items still stored get returned
+	items := table.AddMulti(
+		Entry{Key: "a", Data: 1},
+		Entry{Key: "b", Data: 2},
+		Entry{Key: "b", Data: 3},
+		Entry{Key: "c", Data: 4},
+	)
+	if len(items) != 4 || items[0] != nil || items[1] != nil || items[2].Data() != 3 || items[3].Data() != 4 {
+		t.Error("Error returning only stored items from AddMulti:", items)
+	}
+	if table.Count() != 2 || len(evicted) != 1 || evicted[0] != "a" {
+		t.Error("Error evicting items within AddMulti:", table.Count(), evicted)
+	}
+}
+
+func TestBatchLoaderConcurrency(t *testing.T) {
+	table := NewTable("testBatchLoaderConcurrency")
+	var calls int32
+	release := make(chan struct{})
+	table.SetBatchDataLoaderContext(func(ctx context.Context, keys []interface{}) (map[interface{}]*CacheItem, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		items := make(map[interface{}]*CacheItem)
+		for _, key := range keys {
+			items[key] = NewCacheItem(key, 0, v)
+		}
+		return items, nil
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		table.ValueMulti("a", "b")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	go func() {
+		defer wg.Done()
+		// "a" is being loaded already, only "c" needs another call
+		if r := table.ValueMulti("a", "c"); r[0].Err != nil || r[1].Err != nil {
+			t.Error("Error loading items:", r)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 2 || table.Count() != 3 {
+		t.Error("Error coalescing batch loads:", calls, table.Count())
+	}
+}
+
+func TestBatchLoaderPanic(t *testing.T) {
+	valueMulti := func(table *CacheTable) (p interface{}) {
+		defer func() {
+			p = recover()
+		}()
+		table.ValueMulti("a", "b")
+		return nil
+	}
+
+	table := NewTable("testBatchLoaderPanic")
+	table.SetBatchDataLoader(func(keys []interface{}) (map[interface{}]*CacheItem, error) {
+		panic("boom")
+	})
+	if p, ok := valueMulti(table).(*LoaderPanic); !ok || p.Value != "boom" {
+		t.Error("Error re-raising batch data loader panic:", p)
+	}
+
+	// without a batch data-loader the keys get loaded concurrently
+	table = NewTable("testBatchLoaderPanic")
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		panic("boom")
+	})
+	if p, ok := valueMulti(table).(*LoaderPanic); !ok || p.Value != "boom" {
+		t.Error("Error re-raising data loader panic:", p)
+	}
+}
+
+func TestBatchWindow(t *testing.T) {
+	table := NewTable("testBatchWindow")
+	var m sync.Mutex
+	var calls [][]interface{}
+	table.SetBatchDataLoader(func(keys []interface{}) (map[interface{}]*CacheItem, error) {
+		m.Lock()
+		calls = append(calls, keys)
+		m.Unlock()
+		items := make(map[interface{}]*CacheItem)
+		for _, key := range keys {
+			items[key] = NewCacheItem(key, 0, v)
+		}
+		return items, nil
+	})
+	lookup := func(keys ...string) {
+		var wg sync.WaitGroup
+		for _, key := range keys {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				if _, err := table.Value(key); err != nil {
+					t.Error("Error loading item:", err)
+				}
+			}(key)
+		}
+		wg.Wait()
+	}
+	batches := func() []int {
+		m.Lock()
+		defer m.Unlock()
+		var sizes []int
+		for _, keys := range calls {
+			sizes = append(sizes, len(keys))
+		}
+		calls = nil
+		sort.Ints(sizes)
+		return sizes
+	}
+
+	// a full batch gets dispatched right away
+	table.SetBatchWindow(3, time.Hour)
+	lookup("a", "b", "c")
+	if sizes := batches(); len(sizes) != 1 || sizes[0] != 3 {
+		t.Error("Error dispatching full batch:", sizes)
+	}
+
+	// others once the window passed
+	table.SetBatchWindow(0, 100*time.Millisecond)
+	start := time.Now()
+	lookup("d", "e")
+	if sizes := batches(); len(sizes) != 1 || sizes[0] != 2 || time.Since(start) < 100*time.Millisecond {
+		t.Error("Error collecting keys within batch window:", sizes)
+	}
+
+	// without a window, large batches get split
+	table.SetBatchWindow(2, 0)
+	for _, r := range table.ValueMulti("f", "g", "h", "i", "j") {
+		if r.Err != nil {
+			t.Error("Error loading item:", r.Err)
+		}
+	}
+	if sizes := batches(); len(sizes) != 3 || sizes[0] != 1 || sizes[2] != 2 {
+		t.Error("Error splitting batch:", sizes)
+	}
+
+	// a batch everybody gave up on doesn't take new keys
+	table.SetBatchDataLoaderContext(func(ctx context.Context, keys []interface{}) (map[interface{}]*CacheItem, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		items := make(map[interface{}]*CacheItem)
+		for _, key := range keys {
+			items[key] = NewCacheItem(key, 0, v)
+		}
+		return items, nil
+	})
+	table.SetBatchWindow(0, 200*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := table.ValueContext(ctx, "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Error giving up on batch:", err)
+	}
+	if _, err := table.ValueContext(context.Background(), "l"); err != nil {
+		t.Error("Error loading item after abandoned batch:", err)
+	}
+}
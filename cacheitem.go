@@ -25,7 +25,14 @@ type CacheItem struct {
 	// [ 不再被访问后剩余存活时间 ]
 	// How long will the item live in the cache when not being accessed/kept alive.
 	lifeSpan time.Duration
-
+	// How long will the item live in the cache after being created, no matter
+	// how often it gets accessed.
+	maxAge time.Duration
+
+	// Version assigned by the table when adding the item.
+	version uint64
+	// Clock used for the timestamps of this item.
+	clock Clock
 	// Creation timestamp.
 	createdOn time.Time
 	// Last access timestamp.
@@ -36,6 +43,24 @@ type CacheItem struct {
 	// 该参数的类型是一个切片，可存放多个可接受任意参数类型的函数，作用即item被删除时可能会触发多个回调函数
 	// Callback method triggered right before removing the item from the cache
 	aboutToExpire []func(key interface{})
+	// Callback method triggered right before removing the item from the cache,
+	// for any reason.
+	removed []func(key interface{}, reason RemovalReason)
+
+	// Whether this is a negative entry, remembering a key which couldn't be
+	// loaded.
+	negative bool
+	// Whether the item expired and is only being served during the table's
+	// stale grace period, which ends at staleUntil.
+	stale      bool
+	staleUntil time.Time
+	// When the item may get reloaded in the background again.
+	refreshAfter time.Time
+
+	// Deadline as recorded in the table's expiration heap.
+	expiresAt time.Time
+	// Position in the table's expiration heap, -1 if not part of it.
+	heapIndex int
 }
 
 // NewCacheItem returns a newly created CacheItem.
@@ -44,34 +69,106 @@ type CacheItem struct {
 // will get removed from the cache.
 // Parameter data is the item's value.
 func NewCacheItem(key interface{}, lifeSpan time.Duration, data interface{}) *CacheItem {
-	t := time.Now()
+	return newCacheItem(systemClock, key, lifeSpan, data)
+}
+
+// newCacheItem returns a newly created CacheItem, whose timestamps are taken
+// from clock.
+func newCacheItem(clock Clock, key interface{}, lifeSpan time.Duration, data interface{}) *CacheItem {
+	t := clock.Now()
 	return &CacheItem{
 		key:           key,
 		lifeSpan:      lifeSpan,
+		clock:         clock,
 		createdOn:     t,
 		accessedOn:    t,
 		accessCount:   0,
 		aboutToExpire: nil,
 		data:          data,
+		heapIndex:     -1,
 	}
 }
 
+// ItemOptions configures the expiration of an item.
+type ItemOptions struct {
+	// LifeSpan determines after which time period without an access the item
+	// will get removed from the cache. 0 disables the sliding expiration.
+	LifeSpan time.Duration
+	// MaxAge determines after which time period since its creation the item
+	// will get removed from the cache, no matter how often it was accessed.
+	// 0 disables the absolute expiration.
+	MaxAge time.Duration
+}
+
+// NewCacheItemWithOptions returns a newly created CacheItem, expiring as
+// configured by opts.
+func NewCacheItemWithOptions(key interface{}, data interface{}, opts ItemOptions) *CacheItem {
+	item := NewCacheItem(key, opts.LifeSpan, data)
+	item.maxAge = opts.MaxAge
+	return item
+}
+
 // KeepAlive marks an item to be kept for another expireDuration period.
+// The table picks up the new deadline lazily, once the item's old deadline
+// has been reached.
 // [ 将accessedOn设置为当前时间 ]
 func (item *CacheItem) KeepAlive() {
 	// 因为item继承了sync.RWMutex，所以这里item可以直接调用sync.RWMutex的所有方法，这里是加了一个写锁
 	item.Lock()
 	defer item.Unlock()
-	item.accessedOn = time.Now()
+	item.accessedOn = item.clock.Now()
 	item.accessCount++
 }
 
+// deadline returns when this item expires if not being accessed anymore, or
+// the zero time if it never expires.
+func (item *CacheItem) deadline() time.Time {
+	var t time.Time
+	if item.maxAge > 0 {
+		t = item.createdOn.Add(item.maxAge)
+	}
+	item.RLock()
+	lifeSpan, accessedOn := item.lifeSpan, item.accessedOn
+	item.RUnlock()
+	if lifeSpan > 0 {
+		sliding := accessedOn.Add(lifeSpan)
+		if t.IsZero() || sliding.Before(t) {
+			t = sliding
+		}
+	}
+	return t
+}
+
 // LifeSpan returns this item's expiration duration.
 func (item *CacheItem) LifeSpan() time.Duration {
-	// immutable
+	item.RLock()
+	defer item.RUnlock()
 	return item.lifeSpan
 }
 
+// Version returns the version of this item, which the table assigned when
+// adding it, or when a counter operation like CacheTable.Increment updated it.
+// Every item added or updated gets a higher version than all items before, so
+// it identifies a specific value of a key, see CacheTable.CompareAndSwap.
+// Items not added to a table have version 0.
+func (item *CacheItem) Version() uint64 {
+	item.RLock()
+	defer item.RUnlock()
+	return item.version
+}
+
+// MaxAge returns this item's maximum age, measured from its creation.
+func (item *CacheItem) MaxAge() time.Duration {
+	// immutable
+	return item.maxAge
+}
+
+// ExpiresOn returns when this item will expire unless it gets accessed again,
+// or the zero time if it never expires.
+func (item *CacheItem) ExpiresOn() time.Time {
+	return item.deadline()
+}
+
 // AccessedOn returns when this item was last accessed.
 func (item *CacheItem) AccessedOn() time.Time {
 	// 加读锁
@@ -101,12 +198,14 @@ func (item *CacheItem) Key() interface{} {
 
 // Data returns the value of this cached item.
 func (item *CacheItem) Data() interface{} {
-	// immutable
+	item.RLock()
+	defer item.RUnlock()
 	return item.data
 }
 
 // SetAboutToExpireCallback configures a callback, which will be called right
-// before the item is about to be removed from the cache.
+// before the item is about to be removed from the cache, or right after it got
+// evicted, see CacheTable.SetAboutToDeleteItemCallback.
 // 该函数作用是设置item被删除时触发的回调函数，通过调用RemoveAboutToExpireCallback()函数清空所有回调函数，添加指定要执行的回调函数
 func (item *CacheItem) SetAboutToExpireCallback(f func(interface{})) {
 	if len(item.aboutToExpire) > 0 {
@@ -8,6 +8,7 @@
 package cache2go
 
 import (
+	"context"
 	"log"
 	"sort"
 	"sync"
@@ -26,17 +27,52 @@ type CacheTable struct {
 
 	// [ 负责触发清除操作的计时器 ]
 	// Timer responsible for triggering cleanup.
-	cleanupTimer *time.Timer
+	cleanupTimer Timer
 	// [ 触发清除操作的时间间隔 ]
 	// Current timer duration.
 	cleanupInterval time.Duration
+	// Expiring items, ordered by their deadline.
+	expirations expirationHeap
+	// Source of time for items and expiration checks.
+	clock Clock
+	// Set once the table got dropped from its registry, stops all expiration
+	// checks.
+	closed bool
 
 	// The logger used for this table.
 	logger *log.Logger
 
 	// [ 尝试加载一个不存在的key时触发的回调函数 ]
 	// Callback method triggered when trying to load a non-existing key.
-	loadData func(key interface{}, args ...interface{}) *CacheItem
+	// Both flavors of data-loaders are stored as a context-aware one.
+	loadData func(ctx context.Context, key interface{}, args ...interface{}) (*CacheItem, error)
+	// Callback method triggered when trying to load several non-existing keys
+	// at once.
+	loadBatch func(ctx context.Context, keys []interface{}) (map[interface{}]*CacheItem, error)
+	// Data-loader calls in flight, guarded by loadMutex.
+	loads     map[interface{}]*loadCall
+	loadMutex sync.Mutex
+	// Batch data-loader call collecting keys, guarded by loadMutex.
+	batch *batchCall
+	// Maximum number of keys and time to collect keys for a batch, guarded
+	// by loadMutex.
+	batchSize int
+	batchWait time.Duration
+
+	// How long to remember keys the data-loader couldn't find, 0 disables it.
+	negativeLifeSpan time.Duration
+	// Keys the data-loader couldn't find.
+	negatives map[interface{}]*CacheItem
+	// Fraction of their lifespan left when items get refreshed, 0 disables
+	// refresh-ahead.
+	refreshAhead float64
+	// How long to keep serving items after they expired, 0 disables it.
+	staleGrace time.Duration
+	// Minimum time between background reloads of the same item.
+	refreshRetry time.Duration
+
+	// Codec used to save and load snapshots, gob if nil.
+	codec Codec
 
 	// [ 添加一个新item时触发的回调函数 ]
 	// Callback method triggered when adding a new item to the cache.
@@ -45,6 +81,45 @@ type CacheTable struct {
 	// [ 删除item前触发的回调函数 ]
 	// Callback method triggered before deleting an item from the cache.
 	aboutToDeleteItem []func(item *CacheItem)
+
+	// Callback method triggered before removing an item from the cache, for
+	// any reason.
+	removedItem []func(item *CacheItem, reason RemovalReason)
+
+	// Lifespan of items added with DefaultLifeSpan.
+	defaultLifeSpan time.Duration
+
+	// Maximum number of items kept in the table, 0 means unlimited.
+	maxEntries int
+	// Policy picking the item to evict once maxEntries is reached.
+	evictionPolicy EvictionPolicy
+
+	// How counter operations treat the expiration of existing counters.
+	counterLifeSpan CounterLifeSpan
+
+	// Version of the item added last.
+	version uint64
+
+	// Usage counters.
+	stats *tableStats
+}
+
+// newCacheTable returns a new, empty table with the given name.
+func newCacheTable(name string) *CacheTable {
+	return &CacheTable{
+		name:  name,
+		items: make(map[interface{}]*CacheItem),
+		clock: systemClock,
+		stats: new(tableStats),
+
+		refreshRetry: DefaultRefreshRetryInterval,
+	}
+}
+
+// Name returns the name of this table.
+func (table *CacheTable) Name() string {
+	// immutable
+	return table.name
 }
 
 // Count returns how many items are currently stored in the cache.
@@ -75,9 +150,42 @@ func (table *CacheTable) SetDataLoader(f func(interface{}, ...interface{}) *Cach
 	defer table.Unlock()
 	// 形参f函数被丢给了table的loadData属性，loadData所指向的方法什么时候被调用？
 	// 作者注释说是当访问一个不存在的key时，需要调用一个方法，这个方法通过SetDataLoader设定，方法的实现由用户来定义
+	if f == nil {
+		table.loadData = nil
+		return
+	}
+	table.loadData = func(ctx context.Context, key interface{}, args ...interface{}) (*CacheItem, error) {
+		return f(key, args...), nil
+	}
+}
+
+// SetDataLoaderContext configures a context-aware data-loader callback, which
+// will be called when trying to access a non-existing key. It receives a
+// context carrying the values of the one passed to ValueContext, the key and
+// 0...n additional arguments. Concurrent loads of the same key share a single
+// call, whose context gets cancelled once all of their callers gave up.
+// Returning a nil item and nil error signals that the key doesn't exist,
+// any other error gets passed on to the caller of Value and ValueContext.
+// If it panics, all callers waiting for it panic with a *LoaderPanic.
+// It replaces a data-loader configured via SetDataLoader and vice versa.
+func (table *CacheTable) SetDataLoaderContext(f func(context.Context, interface{}, ...interface{}) (*CacheItem, error)) {
+	table.Lock()
+	defer table.Unlock()
 	table.loadData = f
 }
 
+// SetNegativeLifeSpan enables negative caching: once the data-loader couldn't
+// find a key, Value returns ErrKeyNotFoundOrLoadable for it without calling
+// the data-loader again, until lifeSpan has passed or the key gets added.
+// Negative entries are not items: they are neither counted nor iterated over
+// and Exists reports false for them. Errors returned by a context-aware
+// data-loader never get cached. A lifeSpan of 0 disables negative caching.
+func (table *CacheTable) SetNegativeLifeSpan(lifeSpan time.Duration) {
+	table.Lock()
+	defer table.Unlock()
+	table.negativeLifeSpan = lifeSpan
+}
+
 // SetAddedItemCallback configures a callback, which will be called every time
 // a new item is added to the cache.
 // 创建新item时被调用的回调方法
@@ -115,7 +223,10 @@ func (table *CacheTable) RemoveAddedItemCallbacks() {
 }
 
 // SetAboutToDeleteItemCallback configures a callback, which will be called
-// every time an item is about to be removed from the cache.
+// every time an item is about to be removed from the cache. Items evicted to
+// make room for another item are the exception: as they get evicted within
+// the same atomic operation adding the other item, the callback only gets
+// called right after they were removed.
 func (table *CacheTable) SetAboutToDeleteItemCallback(f func(*CacheItem)) {
 	if len(table.aboutToDeleteItem) > 0 {
 		table.RemoveAboutToDeleteItemCallback()
@@ -139,6 +250,91 @@ func (table *CacheTable) RemoveAboutToDeleteItemCallback() {
 	table.aboutToDeleteItem = nil
 }
 
+// SetMaxEntries limits the table to max items. Once the table is full, adding
+// a new key evicts an item chosen by the table's EvictionPolicy, which
+// defaults to LRU. Evicted items trigger the same callbacks as expired ones,
+// but only once they got removed, see SetAboutToDeleteItemCallback.
+// A max of 0 removes the limit.
+func (table *CacheTable) SetMaxEntries(max int) {
+	table.Lock()
+	table.maxEntries = max
+	if max > 0 && table.evictionPolicy == nil {
+		table.setEvictionPolicy(NewLRUPolicy())
+	}
+	table.unlockEvicting(table.evict(0))
+}
+
+// SetEvictionPolicy configures the policy used to pick items for eviction once
+// the table reaches the limit set by SetMaxEntries.
+func (table *CacheTable) SetEvictionPolicy(policy EvictionPolicy) {
+	table.Lock()
+	table.setEvictionPolicy(policy)
+	table.unlockEvicting(table.evict(0))
+}
+
+func (table *CacheTable) setEvictionPolicy(policy EvictionPolicy) {
+	// Careful: do not run this method unless the table-mutex is locked!
+	table.evictionPolicy = policy
+	if policy == nil {
+		return
+	}
+	// Let the new policy know about the items we already hold.
+	policy.Reset()
+	for key := range table.items {
+		policy.Added(key)
+	}
+}
+
+// evict removes items until there is room for another n items. It returns the
+// evicted items without running their callbacks, so the table stays locked
+// and callers can complete their changes atomically.
+func (table *CacheTable) evict(n int) []*CacheItem {
+	// Careful: do not run this method unless the table-mutex is locked!
+	if table.evictionPolicy == nil {
+		return nil
+	}
+	var evicted []*CacheItem
+	for table.maxEntries > 0 && len(table.items)+n > table.maxEntries {
+		key, ok := table.evictionPolicy.Victim()
+		if !ok {
+			break
+		}
+		r, ok := table.items[key]
+		if !ok {
+			// The policy tracked a key we don't hold (anymore).
+			table.evictionPolicy.Removed(key)
+			continue
+		}
+		table.log("Evicting item with key", key, "from table", table.name)
+		table.expirations.unschedule(r)
+		delete(table.items, key)
+		table.evictionPolicy.Removed(key)
+		evicted = append(evicted, r)
+		inc(&table.stats.evictions)
+	}
+	return evicted
+}
+
+// unlockEvicting unlocks the table and runs the callbacks for the evicted
+// items.
+func (table *CacheTable) unlockEvicting(evicted []*CacheItem) {
+	// Careful: do not run this method unless the table-mutex is locked!
+	aboutToDeleteItem := table.aboutToDeleteItem
+	removedItem := table.removedItem
+	table.Unlock()
+
+	notifyEvicted(aboutToDeleteItem, removedItem, evicted)
+}
+
+// notifyEvicted runs the callbacks for items evicted from a table. Unlike for
+// expired or deleted items, they run after the items were removed, as the
+// table must not be unlocked while making room for a new item.
+func notifyEvicted(aboutToDeleteItem []func(*CacheItem), removedItem []func(*CacheItem, RemovalReason), evicted []*CacheItem) {
+	for _, r := range evicted {
+		notifyDelete(aboutToDeleteItem, removedItem, r, RemovalEvicted)
+	}
+}
+
 // SetLogger sets the logger to be used by this cache table.
 // 把一个logger实例丢给table的logger属性
 func (table *CacheTable) SetLogger(logger *log.Logger) {
@@ -155,6 +351,10 @@ func (table *CacheTable) expirationCheck() {
 	if table.cleanupTimer != nil {
 		table.cleanupTimer.Stop()
 	}
+	if table.closed {
+		table.Unlock()
+		return
+	}
 	// 计时器的时间间隔
 	if table.cleanupInterval > 0 {
 		table.log("Expiration check triggered after", table.cleanupInterval, "for table", table.name)
@@ -165,37 +365,36 @@ func (table *CacheTable) expirationCheck() {
 	// To be more accurate with timers, we would need to update 'now' on every
 	// loop iteration. Not sure it's really efficient though.
 	// 当前时间
-	now := time.Now()
+	now := table.clock.Now()
 	// 定义一个最小时间间隔（后面用于赋值给table的cleanupInterval属性，即触发清除操作的时间间隔），初始化定义为0，下面会更新
 	smallestDuration := 0 * time.Second
-	// 遍历一个table中的items
-	for key, item := range table.items {
-		// Cache values so we don't keep blocking the mutex.
-		item.RLock()
-		// lifeSpan代表不再被访问后剩余存活时间
-		lifeSpan := item.lifeSpan
-		// item的最后一次访问时间
-		accessedOn := item.accessedOn
-		item.RUnlock()
-		// 存活时间为0的item不作处理
-		if lifeSpan == 0 {
+	// Pop expired items off the expiration heap, instead of scanning all items.
+	for item := table.expirations.next(now); item != nil; item = table.expirations.next(now) {
+		if item.expiresAt.After(now) {
+			// Found the item chronologically closest to its end-of-lifespan.
+			smallestDuration = item.expiresAt.Sub(now)
+			break
+		}
+		// Item has excessed its lifespan.
+		if item.negative {
+			table.deleteNegative(item)
 			continue
 		}
-		// time.Now().Sub()是计算时间间隔的方法，这里即计算上一次访问时间到现在的时间间隔。
-		// 如果时间间隔大于剩余存活时间，说明已经过期了，则删除该item
-		if now.Sub(accessedOn) >= lifeSpan {
-			// Item has excessed its lifespan.
-			// 执行删除操作
-			table.deleteInternal(key)
-		} else {
-			// Find the item chronologically closest to its end-of-lifespan.
-			// 这一段else判断主要作用是为了确定 可执行清除item操作的时间间隔值
-			// lifeSpan-now.Sub(accessedOn) item不再被访问后的剩余存活时间 - item上次被访问后到现在的时间间隔 = item到现在剩余的存活时间（过期时间）
-			// 如果 item到现在剩余的存活时间 小于 这段函数里设置的最小时间间隔，则更新最小时间间隔的值（后面传递给table.cleanupInterval以确定清除间隔）
-			if smallestDuration == 0 || lifeSpan-now.Sub(accessedOn) < smallestDuration {
-				smallestDuration = lifeSpan - now.Sub(accessedOn)
-			}
+		if table.items[item.key] != item {
+			// Should never happen, but don't loop forever if it does.
+			table.expirations.unschedule(item)
+			continue
 		}
+		if table.staleGrace > 0 && !item.IsStale() {
+			// Keep serving the item for the grace period.
+			table.log("Item with key", item.key, "in table", table.name, "is stale")
+			table.expirations.unschedule(item)
+			item.markStale(item.expiresAt, table.staleGrace)
+			table.expirations.schedule(item)
+			continue
+		}
+		table.deleteInternal(item.key, RemovalExpired)
+		inc(&table.stats.expirations)
 	}
 
 	// Setup the interval for the next cleanup run.
@@ -203,13 +402,10 @@ func (table *CacheTable) expirationCheck() {
 	table.cleanupInterval = smallestDuration
 	//
 	if smallestDuration > 0 {
-		// time.Now().AfterFunc() 函数用于在指定的时间段后执行指定的函数
+		// clock.AfterFunc() 函数用于在指定的时间段后执行指定的函数
 		// cleanupTimer（负责触发清除操作的计时器）被设置为 smallestDuration，时间到之后执行expirationCheck方法
-		table.cleanupTimer = time.AfterFunc(smallestDuration, func() {
-			// 这里并不是循环启动goroutine，而是启动一个新的goroutine后当前goroutine会退出，这里不会引起goroutine泄漏。
-			go table.expirationCheck()
-			// expirationCheck方法无非是做一个定期的数据过期检查操作
-		})
+		// time.AfterFunc 本身就会在新的goroutine中执行该方法，这里不会引起goroutine泄漏。
+		table.cleanupTimer = table.clock.AfterFunc(smallestDuration, table.expirationCheck)
 	}
 	table.Unlock()
 }
@@ -224,17 +420,23 @@ func (table *CacheTable) addInternal(item *CacheItem) {
 	// 调用addInternal方法前，先要加锁
 	// It will unlock it for the caller before running the callbacks and checks
 	// 它将会在运行回调和检查之前为调用者解锁。
-	table.log("Adding item with key", item.key, "and lifespan of", item.lifeSpan, "to table", table.name)
-	table.items[item.key] = item
+	old, replaced, evicted := table.insert(item)
 
 	// Cache values so we don't keep blocking the mutex.
 	// cleanupInterval [ 触发清除操作的时间间隔 ]
 	expDur := table.cleanupInterval
 	// addedItem 保存的是 [ 添加一个新item时触发的回调函数 ]
 	addedItem := table.addedItem
+	aboutToDeleteItem := table.aboutToDeleteItem
+	removedItem := table.removedItem
 	// 将两个值保存到局部变量之后释放锁
 	table.Unlock()
 
+	notifyEvicted(aboutToDeleteItem, removedItem, evicted)
+	if replaced {
+		notifyRemoved(removedItem, old, RemovalReplaced)
+	}
+
 	// Trigger callback after adding an item to cache.
 	// 局部变量 addedItem 保存的是 [ 添加一个新item时触发的回调函数 ]
 	if addedItem != nil {
@@ -246,25 +448,78 @@ func (table *CacheTable) addInternal(item *CacheItem) {
 
 	// If we haven't set up any expiration check timer or found a more imminent item.
 	// 注释：如果我们没有设置任何过期检查计时器或者找到一个更紧迫的项。
-	// if的第一个条件: item.lifeSpan > 0, 表示当前item的存活时间还没到
+	// if的第一个条件: deadline 不为零值, 表示当前item会过期
 	// expDur保存的是 table.cleanupInterval [ 触发清除操作的时间间隔 ],这个值为0，表示还没有设置任何过期检查计时器
-	// item.lifeSpan < expDur 表示设置了触发清除操作的时间间隔，但是当前新增的item的存活时间要比时间间隔更短
+	// d < expDur 表示设置了触发清除操作的时间间隔，但是当前新增的item距离过期的时间要比时间间隔更短
 	// 满足以上条件之后，就要触发expirationCheck方法
-	if item.lifeSpan > 0 && (expDur == 0 || item.lifeSpan < expDur) {
-		table.expirationCheck()
-	}
+	table.checkExpiration(item, expDur)
 	// lifeSpan 代表的是item的存活时间，而cleanupInterval是对于一个table来说触发检查还剩余的时间，
 	// 如果item的存活时间比触发检查还短，那么就说明需要提前触发expirationCheck操作了
 }
 
+// insert stores item in the table, replacing the item stored for the same key
+// which it returns, if any. It also returns the items evicted to make room
+// for item, whose callbacks the caller has to run once it unlocked the table.
+func (table *CacheTable) insert(item *CacheItem) (old *CacheItem, replaced bool, evicted []*CacheItem) {
+	// Careful: do not run this method unless the table-mutex is locked!
+	if item.lifeSpan == DefaultLifeSpan {
+		item.lifeSpan = table.defaultLifeSpan
+	}
+	item.clock = table.clock
+	table.version++
+	item.version = table.version
+	table.log("Adding item with key", item.key, "and lifespan of", item.lifeSpan, "to table", table.name)
+	// Make room for the new item first, so it can never be its own victim.
+	old, replaced = table.items[item.key]
+	if !replaced {
+		evicted = table.evict(1)
+		inc(&table.stats.adds)
+	} else {
+		table.expirations.unschedule(old)
+		inc(&table.stats.replaces)
+	}
+	if n, ok := table.negatives[item.key]; ok {
+		table.deleteNegative(n)
+	}
+	table.items[item.key] = item
+	table.expirations.schedule(item)
+	if table.evictionPolicy != nil {
+		table.evictionPolicy.Added(item.key)
+	}
+	return old, replaced, evicted
+}
+
+// checkExpiration runs an expiration check if item expires before the next
+// scheduled check, which was due after expDur.
+func (table *CacheTable) checkExpiration(item *CacheItem, expDur time.Duration) {
+	if deadline := item.deadline(); !deadline.IsZero() {
+		if d := deadline.Sub(table.clock.Now()); expDur == 0 || d < expDur {
+			table.expirationCheck()
+		}
+	}
+}
+
+// close stops all expiration checks of this table.
+func (table *CacheTable) close() {
+	table.Lock()
+	defer table.Unlock()
+
+	table.log("Closing table", table.name)
+	table.closed = true
+	table.cleanupInterval = 0
+	if table.cleanupTimer != nil {
+		table.cleanupTimer.Stop()
+	}
+}
+
 // Add adds a key/value pair to the cache.
 // Parameter key is the item's cache-key.
 // Parameter lifeSpan determines after which time period without an access the item
 // will get removed from the cache.
 // Parameter data is the item's value.
 func (table *CacheTable) Add(key interface{}, lifeSpan time.Duration, data interface{}) *CacheItem {
-	// NewCacheItem 函数是cacheitem.go中定义的一个创建CacheItem类型实例的函数，返回值是*CacheItem类型
-	item := NewCacheItem(key, lifeSpan, data)
+	// newCacheItem 函数是cacheitem.go中定义的一个创建CacheItem类型实例的函数，返回值是*CacheItem类型
+	item := newCacheItem(table.clock, key, lifeSpan, data)
 
 	// Add item to cache.
 	table.Lock()
@@ -274,9 +529,44 @@ func (table *CacheTable) Add(key interface{}, lifeSpan time.Duration, data inter
 	return item
 }
 
+// AddWithOptions adds a key/value pair to the cache, expiring as configured by
+// opts. Sliding and absolute expiration can be combined, the item gets
+// removed as soon as either of them is reached.
+func (table *CacheTable) AddWithOptions(key interface{}, data interface{}, opts ItemOptions) *CacheItem {
+	item := table.newItem(key, data, opts)
+
+	table.Lock()
+	table.addInternal(item)
+
+	return item
+}
+
+// newItem returns a new item for this table, expiring as configured by opts.
+func (table *CacheTable) newItem(key interface{}, data interface{}, opts ItemOptions) *CacheItem {
+	item := newCacheItem(table.clock, key, opts.LifeSpan, data)
+	item.maxAge = opts.MaxAge
+	return item
+}
+
+// AddWithDeadline adds a key/value pair to the cache, which gets removed once
+// it hasn't been accessed for lifeSpan or at the latest at deadline.
+// A deadline in the past makes the item expire right away.
+func (table *CacheTable) AddWithDeadline(key interface{}, lifeSpan time.Duration, deadline time.Time, data interface{}) *CacheItem {
+	item := newCacheItem(table.clock, key, lifeSpan, data)
+	item.maxAge = deadline.Sub(item.createdOn)
+	if item.maxAge <= 0 {
+		item.maxAge = time.Nanosecond
+	}
+
+	table.Lock()
+	table.addInternal(item)
+
+	return item
+}
+
 // deleteInternal方法 先看上层调用者Delete方法
 // deleteInternal方法
-func (table *CacheTable) deleteInternal(key interface{}) (*CacheItem, error) {
+func (table *CacheTable) deleteInternal(key interface{}, reason RemovalReason) (*CacheItem, error) {
 	// 获取item的key，未获取到的话直接返回错误，ErrkEeyNotFound是在error.go中定义的
 	r, ok := table.items[key]
 	if !ok {
@@ -287,11 +577,36 @@ func (table *CacheTable) deleteInternal(key interface{}) (*CacheItem, error) {
 	// 第一遍没看懂原作者的注释是是什么作用，先往下看
 	// -- 看了下面的循环语句之后意识到，要解除写锁的原因是要执行删除item前的回调函数，到这里暂时还是不知道前面的注释意思 --
 	aboutToDeleteItem := table.aboutToDeleteItem
+	removedItem := table.removedItem
+	// Unschedule the item right away, so no other expiration check picks it up
+	// while the table is unlocked.
+	table.expirations.unschedule(r)
 	// 回过头来看代码逻辑，deleteInternal方法被Delete方法调用时，是带有写锁的
 	// gpt告诉我在循环调用回调函数之前，使用table.Unlock()解除写锁的目的是为了先释放表的写锁，让其它可能在等待该锁的goroutine有机会执行
 	// 避免因为删除操作导致锁的持有时间过长而阻塞其它操作
 	table.Unlock()
 
+	notifyDelete(aboutToDeleteItem, removedItem, r, reason)
+
+	// 前面的两个for循环，分别先执行了 CacheTable 中 删除item时触发的回调函数，然后执行了 CacheItem 中 item被删除时触发的回调函数
+
+	// 这里对表加上写锁，然后执行delete函数
+	// delete函数的作用专门用来从map中删除特定key指定的元素的
+	table.Lock()
+	table.log("Deleting item with key", key, "created on", r.createdOn, "and hit", r.AccessCount(), "times from table", table.name, "because it was", reason)
+	// The item might have been replaced while the table was unlocked.
+	if table.items[key] == r {
+		delete(table.items, key)
+		if table.evictionPolicy != nil {
+			table.evictionPolicy.Removed(key)
+		}
+	}
+
+	return r, nil
+}
+
+// notifyDelete runs the callbacks for an item being removed from a table.
+func notifyDelete(aboutToDeleteItem []func(*CacheItem), removedItem []func(*CacheItem, RemovalReason), r *CacheItem, reason RemovalReason) {
 	// Trigger callbacks before deleting an item from cache.
 	// aboutToDeleteItem 是 CacheTable struct下面的一个属性， 保存的是 [ 删除一个item时触发的回调函数 ]
 	// 如果删除item时要触发的回调函数不为空，就循环执行这些回调函数
@@ -303,25 +618,17 @@ func (table *CacheTable) deleteInternal(key interface{}) (*CacheItem, error) {
 	}
 
 	r.RLock()
-	defer r.RUnlock()
+	aboutToExpire := r.aboutToExpire
+	r.RUnlock()
 	// aboutToExpire 是 CacheItem struct下面的一个属性， 保存的是 [ item被删除时触发的回调函数 ]
 	// aboutToExpire 属性变量类型和 aboutToDeleteItem 类型是一样的，所以可以循环执行这些回调函数
 	// 这里 r.RLock() 将要删除的item加上一个读锁，然后执行了aboutToExpire回调函数，这个函数需要在item刚好要删除前执行
-	if r.aboutToExpire != nil {
-		for _, callback := range r.aboutToExpire {
-			callback(key)
+	if aboutToExpire != nil {
+		for _, callback := range aboutToExpire {
+			callback(r.key)
 		}
 	}
-
-	// 前面的两个for循环，分别先执行了 CacheTable 中 删除item时触发的回调函数，然后执行了 CacheItem 中 item被删除时触发的回调函数
-
-	// 这里对表加上写锁，前面已经对item加过读锁还没释放，然后这里执行delete函数
-	// delete函数的作用专门用来从map中删除特定key指定的元素的
-	table.Lock()
-	table.log("Deleting item with key", key, "created on", r.createdOn, "and hit", r.accessCount, "times from table", table.name)
-	delete(table.items, key)
-
-	return r, nil
+	notifyRemoved(removedItem, r, reason)
 }
 
 // Delete an item from the cache.
@@ -331,7 +638,44 @@ func (table *CacheTable) Delete(key interface{}) (*CacheItem, error) {
 	table.Lock()
 	defer table.Unlock()
 	// 先调用deleteInternal方法，然后才是defer 解除写锁，也就是说调用deleteInternal方法时是带有写锁的
-	return table.deleteInternal(key)
+	// Forget that the data-loader couldn't find the key, too.
+	if n, ok := table.negatives[key]; ok {
+		table.deleteNegative(n)
+	}
+	r, err := table.deleteInternal(key, RemovalExplicit)
+	if err == nil {
+		inc(&table.stats.deletes)
+	}
+	return r, err
+}
+
+// Touch sets the lifespan of the item stored for key and restarts it, as if
+// the item was added right now. Unlike adding a new item, the item keeps its
+// data, version and access counter and no callbacks get triggered. It
+// returns ErrKeyNotFound if there is no such key.
+func (table *CacheTable) Touch(key interface{}, lifeSpan time.Duration) (*CacheItem, error) {
+	table.Lock()
+	r, ok := table.items[key]
+	if !ok {
+		table.Unlock()
+		return nil, ErrKeyNotFound
+	}
+	if lifeSpan == DefaultLifeSpan {
+		lifeSpan = table.defaultLifeSpan
+	}
+	table.log("Touching item with key", key, "and lifespan of", lifeSpan, "in table", table.name)
+	table.expirations.unschedule(r)
+	r.Lock()
+	r.lifeSpan = lifeSpan
+	r.accessedOn = table.clock.Now()
+	r.stale = false
+	r.Unlock()
+	table.expirations.schedule(r)
+	expDur := table.cleanupInterval
+	table.Unlock()
+
+	table.checkExpiration(r, expDur)
+	return r, nil
 }
 
 // Exists returns whether an item exists in the cache. Unlike the Value method
@@ -347,6 +691,20 @@ func (table *CacheTable) Exists(key interface{}) bool {
 	return ok
 }
 
+// Peek returns the item stored for key without any side effects. Unlike the
+// Value method Peek neither tries to fetch data via the loadData callback nor
+// keeps the item alive, counts a hit or miss or lets the eviction policy know
+// about the access. It returns ErrKeyNotFound if there is no such key.
+func (table *CacheTable) Peek(key interface{}) (*CacheItem, error) {
+	table.RLock()
+	defer table.RUnlock()
+	r, ok := table.items[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return r, nil
+}
+
 // NotFoundAdd checks whether an item is not yet cached. Unlike the Exists
 // method this also adds data if the key could not be found.
 // 该方法检查item是否已经被缓存。和Exists方法不同，即使数据并没有被找到，该方法也会添加该数据
@@ -358,7 +716,7 @@ func (table *CacheTable) NotFoundAdd(key interface{}, lifeSpan time.Duration, da
 		return false
 	}
 	// 当item不存在，则添加该数据
-	item := NewCacheItem(key, lifeSpan, data)
+	item := newCacheItem(table.clock, key, lifeSpan, data)
 	table.addInternal(item)
 
 	return true
@@ -368,31 +726,54 @@ func (table *CacheTable) NotFoundAdd(key interface{}, lifeSpan time.Duration, da
 // pass additional arguments to your DataLoader callback function.
 // 这个方法的作用就是获取缓存中的item值，如果item不存在，则尝试通过loadData回调函数获取item
 func (table *CacheTable) Value(key interface{}, args ...interface{}) (*CacheItem, error) {
+	return table.ValueContext(context.Background(), key, args...)
+}
+
+// ValueContext returns an item from the cache and marks it to be kept alive,
+// just like Value. If the item has to be loaded, ctx gets passed on to the
+// data-loader and ValueContext gives up waiting for it once ctx is done.
+// Errors caused by the data-loader or ctx match ErrKeyNotFoundOrLoadable via
+// errors.Is and unwrap to the underlying error.
+func (table *CacheTable) ValueContext(ctx context.Context, key interface{}, args ...interface{}) (*CacheItem, error) {
 	table.RLock()
 	r, ok := table.items[key]
 	// loadData [ 尝试加载一个不存在的key时触发的回调函数 ]
 	loadData := table.loadData
+	loadBatch := table.loadBatch
+	policy := table.evictionPolicy
+	negative := table.isNegative(key)
+	refreshAhead := table.refreshAhead
 	table.RUnlock()
 	// 如果该key存在，将该item的accessedOn设置为当前时间，将item的accessCount加1
 	if ok {
+		inc(&table.stats.hits)
+		// Check before keeping the item alive, which extends its lifespan.
+		if (loadData != nil || loadBatch != nil) && (r.IsStale() || (refreshAhead > 0 && r.refreshDue(table.clock.Now(), refreshAhead))) {
+			table.refresh(loadData, loadBatch, r, args...)
+		}
 		// Update access counter and timestamp.
 		r.KeepAlive()
+		if policy != nil {
+			policy.Accessed(key)
+		}
 		return r, nil
 	}
+	inc(&table.stats.misses)
 
-	//
 	// Item doesn't exist in cache. Try and fetch it with a data-loader.
-	if loadData != nil {
-		// 通过 loadData 回调函数来尝试获取不存在的item
-		// loadData 函数返回值是 *CacheItem类型
-		item := loadData(key, args...)
-		// 如果通过 loadData获取到了item，则调用 Add 方法将item添加到缓存中
-		if item != nil {
-			table.Add(key, item.lifeSpan, item.data)
-			return item, nil
+	if loadData != nil || loadBatch != nil {
+		if negative {
+			// The data-loader recently couldn't find this key.
+			return nil, ErrKeyNotFoundOrLoadable
+		}
+		if loadData == nil {
+			r := table.loadMulti(ctx, loadBatch, []interface{}{key})[0]
+			return r.Item, r.Err
 		}
-		// 如果通过 loadData 获取不到item，则返回 ErrKeyNotFoundOrLoadable 错误
-		return nil, ErrKeyNotFoundOrLoadable
+		// 通过 loadData 回调函数来尝试获取不存在的item
+		// 如果通过 loadData获取到了item，load 会将item添加到缓存中
+		// 同一个key的并发加载只会调用一次 loadData
+		return table.load(ctx, loadData, key, args...)
 	}
 	// 如果回调函数 loadData 为空，则返回 ErrKeyNotFound 错误
 	return nil, ErrKeyNotFound
@@ -402,12 +783,23 @@ func (table *CacheTable) Value(key interface{}, args ...interface{}) (*CacheItem
 // 该方法总体来说作用就是清空数据的作用
 func (table *CacheTable) Flush() {
 	table.Lock()
-	defer table.Unlock()
 
 	table.log("Flushing table", table.name)
+	inc(&table.stats.flushes)
+	// Cache values so we can run the callbacks without holding the mutex.
+	flushed := table.items
+	removedItem := table.removedItem
 	// 创建一个新的map（map的key可以是任意类型，值类型为*CacheItem）
 	// 这里将一个空的map赋值给table.items，强行达到清空数据的目的
 	table.items = make(map[interface{}]*CacheItem)
+	for _, item := range table.expirations {
+		item.heapIndex = -1
+	}
+	table.expirations = nil
+	table.negatives = nil
+	if table.evictionPolicy != nil {
+		table.evictionPolicy.Reset()
+	}
 	// cleanupTimer [ 负责触发清除操作的计时器 ]
 	// cleanupInterval [ 触发清除操作的时间间隔 ]
 	// 将 cleanupInterval 设置为0，即间隔为0，表示不触发清除操作，因为缓存表此时是空的
@@ -416,6 +808,11 @@ func (table *CacheTable) Flush() {
 	if table.cleanupTimer != nil {
 		table.cleanupTimer.Stop()
 	}
+	table.Unlock()
+
+	for _, item := range flushed {
+		notifyRemoved(removedItem, item, RemovalFlushed)
+	}
 }
 
 // CacheItemPair maps key to access counter
@@ -0,0 +1,61 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import "time"
+
+// CompareAndSwap replaces the item stored for key with a new one, but only if
+// the current item has the given version. It returns ErrKeyNotFound if there
+// is no such key and ErrVersionMismatch if the item was replaced since its
+// version was read, e.g. by another goroutine:
+//
+//	item, _ := table.Value(key)
+//	_, err := table.CompareAndSwap(key, item.Version(), lifeSpan, update(item.Data()))
+//	if err == cache2go.ErrVersionMismatch {
+//		// somebody else won, retry
+//	}
+func (table *CacheTable) CompareAndSwap(key interface{}, version uint64, lifeSpan time.Duration, data interface{}) (*CacheItem, error) {
+	table.Lock()
+	if err := table.checkVersion(key, version); err != nil {
+		table.Unlock()
+		return nil, err
+	}
+
+	item := newCacheItem(table.clock, key, lifeSpan, data)
+	table.addInternal(item)
+	return item, nil
+}
+
+// CompareAndDelete deletes the item stored for key, but only if it has the
+// given version. It fails just like CompareAndSwap.
+func (table *CacheTable) CompareAndDelete(key interface{}, version uint64) (*CacheItem, error) {
+	table.Lock()
+	defer table.Unlock()
+	if err := table.checkVersion(key, version); err != nil {
+		return nil, err
+	}
+
+	r, err := table.deleteInternal(key, RemovalExplicit)
+	if err == nil {
+		inc(&table.stats.deletes)
+	}
+	return r, err
+}
+
+// checkVersion checks whether the item stored for key has the given version.
+func (table *CacheTable) checkVersion(key interface{}, version uint64) error {
+	// Careful: do not run this method unless the table-mutex is locked!
+	item, ok := table.items[key]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	if item.version != version {
+		return ErrVersionMismatch
+	}
+	return nil
+}
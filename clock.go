@@ -0,0 +1,48 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import "time"
+
+// Clock is the source of time of a table, used for timestamps of items and to
+// schedule expiration checks. Tables use the system clock, unless configured
+// otherwise via WithClock, e.g. to drive expirations by a fake clock in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// AfterFunc calls f once d has elapsed.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a call scheduled via Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the call from happening. It returns false if the call
+	// already happened or got stopped before.
+	Stop() bool
+}
+
+// systemClock is the Clock used unless configured otherwise.
+var systemClock Clock = realClock{}
+
+// realClock is a Clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// WithClock configures the clock used by the table.
+func WithClock(clock Clock) TableOption {
+	return func(table *CacheTable) {
+		table.clock = clock
+	}
+}
@@ -0,0 +1,398 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/muesli/cache2go"
+	"github.com/muesli/cache2go/clocktest"
+)
+
+var (
+	k = "testkey"
+	v = "testvalue"
+)
+
+// newFakeTable returns a private table driven by a fake clock.
+func newFakeTable(name string) (*cache2go.CacheTable, *clocktest.FakeClock) {
+	clock := clocktest.NewFakeClock(time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC))
+	return cache2go.NewTable(name, cache2go.WithClock(clock)), clock
+}
+
+func TestCacheExpire(t *testing.T) {
+	table, clock := newFakeTable("testCache")
+
+	table.Add(k+"_1", 250*time.Millisecond, v+"_1")
+	table.Add(k+"_2", 200*time.Millisecond, v+"_2")
+
+	clock.Advance(100 * time.Millisecond)
+
+	// check key `1` is still alive
+	_, err := table.Value(k + "_1")
+	if err != nil {
+		t.Error("Error retrieving value from cache:", err)
+	}
+
+	clock.Advance(150 * time.Millisecond)
+
+	// check key `1` again, it should still be alive since we just accessed it
+	_, err = table.Value(k + "_1")
+	if err != nil {
+		t.Error("Error retrieving value from cache:", err)
+	}
+
+	// check key `2`, it should have been removed by now
+	_, err = table.Value(k + "_2")
+	if err == nil {
+		t.Error("Found key which should have been expired by now")
+	}
+}
+
+func TestCacheKeepAlive(t *testing.T) {
+	// add an expiring item
+	table, clock := newFakeTable("testKeepAlive")
+	p := table.Add(k, 250*time.Millisecond, v)
+
+	// keep it alive before it expires
+	clock.Advance(100 * time.Millisecond)
+	p.KeepAlive()
+
+	// check it's still alive after it was initially supposed to expire
+	clock.Advance(150 * time.Millisecond)
+	if !table.Exists(k) {
+		t.Error("Error keeping item alive")
+	}
+
+	// check it expires exactly once its extended lifespan is over
+	clock.Advance(99 * time.Millisecond)
+	if !table.Exists(k) {
+		t.Error("Error keeping item alive for its whole lifespan")
+	}
+	clock.Advance(time.Millisecond)
+	if table.Exists(k) {
+		t.Error("Error expiring item after keeping it alive")
+	}
+}
+
+func TestAbsoluteExpiration(t *testing.T) {
+	table, clock := newFakeTable("testAbsoluteExpiration")
+	p := table.AddWithOptions(k, v, cache2go.ItemOptions{
+		LifeSpan: 100 * time.Millisecond,
+		MaxAge:   250 * time.Millisecond,
+	})
+	if p.MaxAge() != 250*time.Millisecond || !p.ExpiresOn().Equal(p.CreatedOn().Add(100*time.Millisecond)) {
+		t.Error("Error getting correct expiration of item")
+	}
+	table.AddWithDeadline(k+"_deadline", 0, clock.Now().Add(150*time.Millisecond), v)
+
+	// keep the item alive, it must expire after its max age regardless
+	for i := 0; i < 4; i++ {
+		clock.Advance(50 * time.Millisecond)
+		if _, err := table.Value(k); err != nil {
+			t.Error("Error retrieving value from cache:", err)
+		}
+	}
+	if table.Exists(k + "_deadline") {
+		t.Error("Found key which should have been expired by its deadline")
+	}
+	clock.Advance(50 * time.Millisecond)
+	if table.Exists(k) {
+		t.Error("Found key which should have been expired by its max age")
+	}
+}
+
+func TestTouch(t *testing.T) {
+	table, clock := newFakeTable("testTouch")
+	var added int32
+	table.SetAddedItemCallback(func(*cache2go.CacheItem) {
+		atomic.AddInt32(&added, 1)
+	})
+	p := table.Add(k, 100*time.Millisecond, v)
+
+	clock.Advance(50 * time.Millisecond)
+	r, err := table.Touch(k, 200*time.Millisecond)
+	if err != nil || r != p || r.Version() != p.Version() || r.LifeSpan() != 200*time.Millisecond {
+		t.Error("Error touching item in place:", err)
+	}
+	if r.AccessCount() != 0 || added != 1 {
+		t.Error("Error touching item without side effects:", r.AccessCount(), added)
+	}
+
+	clock.Advance(150 * time.Millisecond)
+	if !table.Exists(k) {
+		t.Error("Error extending lifespan of touched item")
+	}
+	clock.Advance(50 * time.Millisecond)
+	if table.Exists(k) {
+		t.Error("Found key which should have been expired by now")
+	}
+	if _, err := table.Touch(k, 0); err != cache2go.ErrKeyNotFound {
+		t.Error("Expected error touching missing item:", err)
+	}
+}
+
+func TestShardedTableOptions(t *testing.T) {
+	clock := clocktest.NewFakeClock(time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC))
+	table := cache2go.NewShardedTable("testShardedTableOptions", 4,
+		cache2go.WithClock(clock),
+		cache2go.WithDefaultLifeSpan(time.Second),
+		cache2go.WithMaxEntries(100))
+	if table.Name() != "testShardedTableOptions" {
+		t.Error("Error getting name of sharded table:", table.Name())
+	}
+
+	for i := 0; i < 200; i++ {
+		table.Add(i, cache2go.DefaultLifeSpan, v)
+	}
+	// the limit is split across shards, which may evict slightly early
+	if n := table.Count(); n > 100 || n < 50 {
+		t.Error("Error limiting sharded table to max entries:", n)
+	}
+	clock.Advance(time.Second)
+	if table.Count() != 0 {
+		t.Error("Error expiring items of sharded table by its clock:", table.Count())
+	}
+
+	// every shard needs its own eviction policy
+	var policies int
+	table = cache2go.NewShardedTable("testShardedTableOptions", 4,
+		cache2go.WithMaxEntries(4),
+		cache2go.WithEvictionPolicyFunc(func() cache2go.EvictionPolicy {
+			policies++
+			return cache2go.NewLRUPolicy()
+		}))
+	if policies != 4 {
+		t.Error("Error creating eviction policy per shard:", policies)
+	}
+
+	// a shared eviction policy gets ignored in favor of LRU
+	table = cache2go.NewShardedTable("testShardedTableOptions", 4,
+		cache2go.WithMaxEntries(4),
+		cache2go.WithEvictionPolicy(cache2go.NewLRUPolicy()))
+	for i := 0; i < 100; i++ {
+		table.Add(i, 0, v)
+	}
+	if n := table.Count(); n > 4 || n == 0 {
+		t.Error("Error limiting sharded table ignoring shared eviction policy:", n)
+	}
+}
+
+func TestFakeClockCallbacks(t *testing.T) {
+	table, clock := newFakeTable("testFakeClockCallbacks")
+	var removed []string
+	table.SetRemovedItemCallback(func(item *cache2go.CacheItem, reason cache2go.RemovalReason) {
+		removed = append(removed, item.Key().(string)+" "+reason.String())
+		if !clock.Now().Equal(item.ExpiresOn()) {
+			t.Error("Error expiring item at its deadline:", clock.Now(), item.ExpiresOn())
+		}
+	})
+
+	table.Add("b", 2*time.Second, v)
+	table.Add("a", time.Second, v)
+	if clock.Pending() != 1 {
+		t.Error("Error scheduling a single expiration check:", clock.Pending())
+	}
+
+	clock.Advance(time.Hour)
+	if len(removed) != 2 || removed[0] != "a expired" || removed[1] != "b expired" {
+		t.Error("Error expiring items in order:", removed)
+	}
+	if clock.Pending() != 0 {
+		t.Error("Error stopping expiration checks of empty table:", clock.Pending())
+	}
+}
+
+func TestCounterLifeSpan(t *testing.T) {
+	clock := clocktest.NewFakeClock(time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC))
+	refresh := cache2go.NewTable("testRefreshCounter", cache2go.WithClock(clock))
+	preserve := cache2go.NewTable("testPreserveCounter", cache2go.WithClock(clock),
+		cache2go.WithCounterLifeSpan(cache2go.PreserveLifeSpan))
+
+	for _, table := range []*cache2go.CacheTable{refresh, preserve} {
+		table.Increment(k, 1, time.Minute)
+	}
+	clock.Advance(30 * time.Second)
+	for _, table := range []*cache2go.CacheTable{refresh, preserve} {
+		table.Increment(k, 1, time.Minute)
+	}
+	clock.Advance(30 * time.Second)
+
+	if !refresh.Exists(k) {
+		t.Error("Error refreshing lifespan of counter")
+	}
+	if preserve.Exists(k) {
+		t.Error("Error preserving lifespan of counter")
+	}
+	if n, _ := preserve.Increment(k, 1, time.Minute); n != 1 {
+		t.Error("Error restarting expired counter:", n)
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	clock := clocktest.NewFakeClock(time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC))
+	loads := make(chan int, 10)
+	var n int
+	table := cache2go.NewTable("testRefreshAhead",
+		cache2go.WithClock(clock),
+		cache2go.WithRefreshAhead(0.2),
+		cache2go.WithLoader(func(key interface{}, args ...interface{}) *cache2go.CacheItem {
+			n++
+			loads <- n
+			return cache2go.NewCacheItemWithOptions(key, n, cache2go.ItemOptions{MaxAge: 10 * time.Second})
+		}),
+	)
+
+	value := func() interface{} {
+		p, err := table.Value(k)
+		if err != nil {
+			t.Fatal("Error retrieving value from cache:", err)
+		}
+		return p.Data()
+	}
+	if value() != 1 || <-loads != 1 {
+		t.Error("Error loading item")
+	}
+
+	clock.Advance(5 * time.Second)
+	if value() != 1 || len(loads) != 0 {
+		t.Error("Error refreshing item too early")
+	}
+
+	// less than 20% of its max age left: serve the current value, but refresh
+	clock.Advance(4 * time.Second)
+	if value() != 1 {
+		t.Error("Error serving current value while refreshing")
+	}
+	select {
+	case <-loads:
+	case <-time.After(time.Second):
+		t.Fatal("Error refreshing item in the background")
+	}
+	for i := 0; i < 100 && value() != 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the refreshed item outlives the original one
+	clock.Advance(3 * time.Second)
+	if value() != 2 {
+		t.Error("Error replacing item with refreshed one")
+	}
+}
+
+func TestRefreshAheadConcurrency(t *testing.T) {
+	clock := clocktest.NewFakeClock(time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC))
+	var loads int32
+	table := cache2go.NewTable("testRefreshAheadConcurrency",
+		cache2go.WithClock(clock),
+		cache2go.WithRefreshAhead(0.2),
+		cache2go.WithLoader(func(key interface{}, args ...interface{}) *cache2go.CacheItem {
+			n := atomic.AddInt32(&loads, 1)
+			return cache2go.NewCacheItemWithOptions(key, n, cache2go.ItemOptions{MaxAge: 10 * time.Second})
+		}),
+	)
+	table.AddWithOptions(k, int32(0), cache2go.ItemOptions{MaxAge: 10 * time.Second})
+
+	// all hits on the hot item share a single refresh
+	clock.Advance(9 * time.Second)
+	var finish sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		finish.Add(1)
+		go func() {
+			defer finish.Done()
+			table.Value(k)
+		}()
+	}
+	finish.Wait()
+	for i := 0; i < 100; i++ {
+		if p, _ := table.Peek(k); p.Data() != int32(0) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Error("Error coalescing refreshes of hot item:", n)
+	}
+}
+
+func TestStaleGracePeriod(t *testing.T) {
+	clock := clocktest.NewFakeClock(time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC))
+	loads := make(chan error, 10)
+	var fail int32
+	table := cache2go.NewTable("testStaleGracePeriod",
+		cache2go.WithClock(clock),
+		cache2go.WithStaleGracePeriod(5*time.Second),
+		cache2go.WithLoaderContext(func(ctx context.Context, key interface{}, args ...interface{}) (*cache2go.CacheItem, error) {
+			var err error
+			if atomic.LoadInt32(&fail) == 1 {
+				err = errors.New("backend down")
+			}
+			defer func() { loads <- err }()
+			if err != nil {
+				return nil, err
+			}
+			return cache2go.NewCacheItem(key, 10*time.Second, "fresh"), nil
+		}),
+	)
+	table.Add(k, 10*time.Second, v)
+
+	// expired, but still served as stale while the reload fails
+	atomic.StoreInt32(&fail, 1)
+	clock.Advance(11 * time.Second)
+	p, err := table.Value(k)
+	if err != nil || p.Data() != v || !p.IsStale() {
+		t.Fatal("Error serving stale item:", err)
+	}
+	if err := <-loads; err == nil {
+		t.Error("Expected reload of stale item to fail")
+	}
+	// don't retry the data-loader on every access
+	if p, err := table.Value(k); err != nil || p.Data() != v {
+		t.Error("Error serving stale item after failed reload:", err)
+	}
+	select {
+	case <-loads:
+		t.Error("Error retrying reload of stale item too early")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// a successful reload replaces the stale item
+	atomic.StoreInt32(&fail, 0)
+	clock.Advance(cache2go.DefaultRefreshRetryInterval)
+	table.Value(k)
+	if err := <-loads; err != nil {
+		t.Fatal("Error reloading stale item:", err)
+	}
+	for i := 0; i < 100; i++ {
+		if p, _ := table.Value(k); !p.IsStale() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if p, err := table.Value(k); err != nil || p.Data() != "fresh" || p.IsStale() {
+		t.Error("Error replacing stale item")
+	}
+
+	// without a successful reload, stale items get removed after the grace period
+	table.SetDataLoaderContext(nil)
+	table.Add("other", 10*time.Second, v)
+	clock.Advance(14 * time.Second)
+	if p, err := table.Value("other"); err != nil || !p.IsStale() {
+		t.Error("Error serving stale item without data-loader:", err)
+	}
+	clock.Advance(2 * time.Second)
+	if table.Exists("other") {
+		t.Error("Error removing stale item after its grace period")
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+// Package clocktest provides a fake cache2go.Clock, which lets tests control
+// the passing of time and observe expirations deterministically:
+//
+//	clock := clocktest.NewFakeClock(time.Now())
+//	table := cache2go.NewTable("test", cache2go.WithClock(clock))
+//	table.Add("key", time.Second, "value")
+//	clock.Advance(time.Second) // "key" expires before Advance returns
+package clocktest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/muesli/cache2go"
+)
+
+// FakeClock is a cache2go.Clock which only moves forward when told to. Calls
+// scheduled via AfterFunc run synchronously in the goroutine advancing the
+// clock, so their effects are visible as soon as Advance returns.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// fakeTimer is a call scheduled on a FakeClock.
+type fakeTimer struct {
+	clock *FakeClock
+	when  time.Time
+	f     func()
+}
+
+// NewFakeClock returns a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc schedules f to be called once the clock advanced by d. Calls with
+// a d of 0 or less happen during the next call of Advance or Set.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) cache2go.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, running all calls due in the meantime
+// in chronological order. While a call runs, the clock reports the time it
+// was scheduled for.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock forward to t, just like Advance. The clock never moves
+// backward, a t before the current time only runs calls which are overdue.
+func (c *FakeClock) Set(t time.Time) {
+	for {
+		c.mu.Lock()
+		next := -1
+		for i, timer := range c.timers {
+			if !timer.when.After(t) && (next < 0 || timer.when.Before(c.timers[next].when)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			if t.After(c.now) {
+				c.now = t
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		timer := c.timers[next]
+		c.timers = append(c.timers[:next], c.timers[next+1:]...)
+		if timer.when.After(c.now) {
+			c.now = timer.when
+		}
+		c.mu.Unlock()
+
+		timer.f()
+	}
+}
+
+// Pending returns the number of calls scheduled but not run yet.
+func (c *FakeClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// Stop prevents the call from happening. It returns false if the call already
+// happened or got stopped before.
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, timer := range c.timers {
+		if timer == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
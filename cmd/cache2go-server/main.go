@@ -0,0 +1,90 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+// Command cache2go-server serves a cache2go table to other processes.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/muesli/cache2go"
+	"github.com/muesli/cache2go/metrics"
+	"github.com/muesli/cache2go/server"
+)
+
+func main() {
+	memcachedAddr := flag.String("memcached", ":11211", "address to serve the memcached text protocol on")
+	respAddr := flag.String("resp", "", "address to serve the Redis protocol on, disabled if empty")
+	httpAddr := flag.String("http", "", "address to serve the HTTP API and metrics on, disabled if empty")
+	tableName := flag.String("table", "default", "name of the table to serve via memcached")
+	respPrefix := flag.String("resp-prefix", "db", "table name prefix of the Redis databases")
+	respDatabases := flag.Int("resp-databases", server.DefaultDatabases, "number of Redis databases")
+	verbose := flag.Bool("verbose", false, "log every cache operation")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "cache2go ", log.LstdFlags)
+	table := cache2go.Cache(*tableName)
+	if *verbose {
+		table.SetLogger(logger)
+	}
+
+	mc := server.NewMemcached(table)
+	mc.SetLogger(logger)
+	go func() {
+		logger.Println("Serving memcached protocol on", *memcachedAddr)
+		if err := mc.ListenAndServe(*memcachedAddr); err != server.ErrServerClosed {
+			logger.Fatal(err)
+		}
+	}()
+
+	var rs *server.RESP
+	if *respAddr != "" {
+		rs = server.NewRESP(*respPrefix)
+		rs.SetDatabases(*respDatabases)
+		rs.SetLogger(logger)
+		go func() {
+			logger.Println("Serving Redis protocol on", *respAddr)
+			if err := rs.ListenAndServe(*respAddr); err != server.ErrServerClosed {
+				logger.Fatal(err)
+			}
+		}()
+	}
+
+	var hs *http.Server
+	if *httpAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		api := server.NewHTTPHandler()
+		api.SetValueEncoder(*tableName, server.BytesEncoder{})
+		mux.Handle("/", api)
+		hs = &http.Server{Addr: *httpAddr, Handler: mux}
+		go func() {
+			logger.Println("Serving HTTP API on", *httpAddr)
+			if err := hs.ListenAndServe(); err != http.ErrServerClosed {
+				logger.Fatal(err)
+			}
+		}()
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	logger.Println("Shutting down")
+	mc.Close()
+	if rs != nil {
+		rs.Close()
+	}
+	if hs != nil {
+		hs.Close()
+	}
+}
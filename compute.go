@@ -0,0 +1,72 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import "time"
+
+// Compute atomically updates the item stored for key. It calls f with the
+// current item, or nil and false if there is none, and stores newData with
+// the given lifeSpan if f returns keep, replacing the current item. Otherwise
+// the current item gets deleted. It returns the new item, or nil if there is
+// none.
+// f runs while the table is locked, so it must not call any methods of the
+// table. Callbacks run after the table got unlocked, just like with Add and
+// Delete.
+func (table *CacheTable) Compute(key interface{}, f func(old *CacheItem, exists bool) (newData interface{}, lifeSpan time.Duration, keep bool)) *CacheItem {
+	table.Lock()
+	old, exists := table.items[key]
+	newData, lifeSpan, keep := f(old, exists)
+	return table.computed(key, exists, newData, lifeSpan, keep)
+}
+
+// ComputeIfAbsent atomically adds an item for key, unless there is one
+// already. It calls f only if key is missing and stores newData with the
+// given lifeSpan if f returns keep. It returns the item stored for key, or nil
+// if there is none.
+func (table *CacheTable) ComputeIfAbsent(key interface{}, f func() (newData interface{}, lifeSpan time.Duration, keep bool)) *CacheItem {
+	table.Lock()
+	if old, ok := table.items[key]; ok {
+		table.Unlock()
+		return old
+	}
+	newData, lifeSpan, keep := f()
+	return table.computed(key, false, newData, lifeSpan, keep)
+}
+
+// ComputeIfPresent atomically updates the item stored for key, if there is one.
+// It calls f only if key exists and replaces the current item just like
+// Compute. It returns the new item, or nil if there is none.
+func (table *CacheTable) ComputeIfPresent(key interface{}, f func(old *CacheItem) (newData interface{}, lifeSpan time.Duration, keep bool)) *CacheItem {
+	table.Lock()
+	old, ok := table.items[key]
+	if !ok {
+		table.Unlock()
+		return nil
+	}
+	newData, lifeSpan, keep := f(old)
+	return table.computed(key, true, newData, lifeSpan, keep)
+}
+
+// computed stores or deletes the item for key, as a compute function decided.
+func (table *CacheTable) computed(key interface{}, exists bool, newData interface{}, lifeSpan time.Duration, keep bool) *CacheItem {
+	// Careful: do not run this method unless the table-mutex is locked!
+	// It will unlock it for the caller.
+	if keep {
+		item := newCacheItem(table.clock, key, lifeSpan, newData)
+		table.addInternal(item)
+		return item
+	}
+
+	if exists {
+		if _, err := table.deleteInternal(key, RemovalExplicit); err == nil {
+			inc(&table.stats.deletes)
+		}
+	}
+	table.Unlock()
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import "time"
+
+// CounterLifeSpan determines how counter operations like Increment treat the
+// expiration of counters which exist already.
+type CounterLifeSpan int
+
+const (
+	// RefreshLifeSpan restarts the expiration of a counter with every update,
+	// using the lifespan passed to the update.
+	RefreshLifeSpan CounterLifeSpan = iota
+	// PreserveLifeSpan keeps the expiration a counter got when it was created,
+	// e.g. for counting within fixed windows of time.
+	PreserveLifeSpan
+)
+
+// WithCounterLifeSpan configures how counter operations treat the expiration
+// of existing counters. It defaults to RefreshLifeSpan.
+func WithCounterLifeSpan(mode CounterLifeSpan) TableOption {
+	return func(table *CacheTable) {
+		table.counterLifeSpan = mode
+	}
+}
+
+// SetCounterLifeSpan configures how counter operations treat the expiration
+// of existing counters, see WithCounterLifeSpan.
+func (table *CacheTable) SetCounterLifeSpan(mode CounterLifeSpan) {
+	table.Lock()
+	defer table.Unlock()
+	table.counterLifeSpan = mode
+}
+
+// Increment atomically adds delta to the integer stored for key and returns
+// the new value. Missing counters get created with a value of delta and the
+// given lifeSpan, existing ones get updated in place without triggering any
+// callbacks. The counter is stored as an int64, but it may be created
+// via Add with any integer type. Overflows wrap around. It returns a
+// NotNumericError if the item holds anything but an integer.
+func (table *CacheTable) Increment(key interface{}, delta int64, lifeSpan time.Duration) (int64, error) {
+	var n int64
+	err := table.updateCounter(key, lifeSpan, func(data interface{}, exists bool) (interface{}, bool) {
+		if exists {
+			var ok bool
+			if n, ok = toInt64(data); !ok {
+				return nil, false
+			}
+		}
+		n += delta
+		return n, true
+	})
+	return n, err
+}
+
+// Decrement atomically subtracts delta from the integer stored for key, see
+// Increment.
+func (table *CacheTable) Decrement(key interface{}, delta int64, lifeSpan time.Duration) (int64, error) {
+	return table.Increment(key, -delta, lifeSpan)
+}
+
+// IncrementFloat atomically adds delta to the number stored for key and
+// returns the new value. Missing counters get created with a value of delta
+// and the given lifeSpan. The counter is stored as a float64, but it may be
+// created via Add with any integer or float type. It returns a
+// NotNumericError if the item holds anything but a number.
+func (table *CacheTable) IncrementFloat(key interface{}, delta float64, lifeSpan time.Duration) (float64, error) {
+	var f float64
+	err := table.updateCounter(key, lifeSpan, func(data interface{}, exists bool) (interface{}, bool) {
+		if exists {
+			var ok bool
+			if f, ok = toFloat64(data); !ok {
+				return nil, false
+			}
+		}
+		f += delta
+		return f, true
+	})
+	return f, err
+}
+
+// DecrementFloat atomically subtracts delta from the number stored for key,
+// see IncrementFloat.
+func (table *CacheTable) DecrementFloat(key interface{}, delta float64, lifeSpan time.Duration) (float64, error) {
+	return table.IncrementFloat(key, -delta, lifeSpan)
+}
+
+// updateCounter updates the counter stored for key to the data returned by f.
+// f returns false if the current data is not numeric.
+func (table *CacheTable) updateCounter(key interface{}, lifeSpan time.Duration, f func(data interface{}, exists bool) (interface{}, bool)) error {
+	table.Lock()
+	r, exists := table.items[key]
+	var data interface{}
+	if exists {
+		r.RLock()
+		data = r.data
+		r.RUnlock()
+	}
+	n, ok := f(data, exists)
+	if !ok {
+		table.Unlock()
+		return &NotNumericError{Key: key, Data: data}
+	}
+	if !exists {
+		table.addInternal(newCacheItem(table.clock, key, lifeSpan, n))
+		return nil
+	}
+
+	// Update the counter in place, just like Touch does, so no callbacks get
+	// triggered. Its version changes nonetheless, as its data does.
+	if lifeSpan == DefaultLifeSpan {
+		lifeSpan = table.defaultLifeSpan
+	}
+	refresh := table.counterLifeSpan == RefreshLifeSpan
+	if refresh {
+		table.expirations.unschedule(r)
+	}
+	table.version++
+	r.Lock()
+	r.data = n
+	r.version = table.version
+	if refresh {
+		r.lifeSpan = lifeSpan
+		r.accessedOn = table.clock.Now()
+		r.stale = false
+	}
+	r.Unlock()
+	if refresh {
+		table.expirations.schedule(r)
+	}
+	expDur := table.cleanupInterval
+	policy := table.evictionPolicy
+	table.Unlock()
+
+	if policy != nil {
+		policy.Accessed(key)
+	}
+	if refresh {
+		table.checkExpiration(r, expDur)
+	}
+	return nil
+}
+
+// toInt64 converts integers of any type to an int64.
+func toInt64(data interface{}) (int64, bool) {
+	switch d := data.(type) {
+	case int:
+		return int64(d), true
+	case int8:
+		return int64(d), true
+	case int16:
+		return int64(d), true
+	case int32:
+		return int64(d), true
+	case int64:
+		return d, true
+	case uint:
+		return int64(d), true
+	case uint8:
+		return int64(d), true
+	case uint16:
+		return int64(d), true
+	case uint32:
+		return int64(d), true
+	case uint64:
+		return int64(d), true
+	}
+	return 0, false
+}
+
+// toFloat64 converts numbers of any type to a float64.
+func toFloat64(data interface{}) (float64, bool) {
+	switch d := data.(type) {
+	case float64:
+		return d, true
+	case float32:
+		return float64(d), true
+	}
+	n, ok := toInt64(data)
+	return float64(n), ok
+}
@@ -9,6 +9,7 @@ package cache2go
 
 import (
 	"errors"
+	"fmt"
 )
 
 var (
@@ -17,4 +18,66 @@ var (
 	// ErrKeyNotFoundOrLoadable gets returned when a specific key couldn't be
 	// found and loading via the data-loader callback also failed
 	ErrKeyNotFoundOrLoadable = errors.New("Key not found and could not be loaded into cache")
+	// ErrVersionMismatch gets returned when a compare-and-swap operation
+	// found an item with another version than expected
+	ErrVersionMismatch = errors.New("Item version does not match")
+	// ErrNotNumeric gets returned when a counter operation found an item
+	// whose data is not a number
+	ErrNotNumeric = errors.New("Item data is not numeric")
 )
+
+// LoadError gets returned when the data-loader callback failed to load a key,
+// or the context passed to ValueContext was done before it finished.
+// It matches ErrKeyNotFoundOrLoadable via errors.Is and unwraps to the
+// underlying error.
+type LoadError struct {
+	// Key which could not be loaded.
+	Key interface{}
+	// Err is the error returned by the data-loader or the context.
+	Err error
+}
+
+func (e *LoadError) Error() string {
+	return ErrKeyNotFoundOrLoadable.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrKeyNotFoundOrLoadable.
+func (e *LoadError) Is(target error) bool {
+	return target == ErrKeyNotFoundOrLoadable
+}
+
+// NotNumericError gets returned by counter operations like Increment when the
+// item stored for a key holds data which is not a number. It matches
+// ErrNotNumeric via errors.Is.
+type NotNumericError struct {
+	// Key of the item.
+	Key interface{}
+	// Data is the data stored in the item.
+	Data interface{}
+}
+
+func (e *NotNumericError) Error() string {
+	return fmt.Sprintf("%s: %v holds %T", ErrNotNumeric, e.Key, e.Data)
+}
+
+// Is reports whether target is ErrNotNumeric.
+func (e *NotNumericError) Is(target error) bool {
+	return target == ErrNotNumeric
+}
+
+// LoaderPanic is the value of the panic raised in all goroutines waiting for a
+// data-loader which panicked. It carries the original panic value and the
+// stack trace of the data-loader's goroutine.
+type LoaderPanic struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *LoaderPanic) Error() string {
+	return fmt.Sprintf("cache2go: data-loader panicked: %v\n\n%s", p.Value, p.Stack)
+}
@@ -0,0 +1,286 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"container/heap"
+	"container/list"
+	"math/rand"
+	"sync"
+)
+
+// EvictionPolicy decides which item gets removed from a table once it holds
+// its maximum number of entries. The table reports every key it adds,
+// accesses and removes, and asks for a victim whenever it needs room.
+// Implementations must be safe for concurrent use, as Accessed gets called
+// while the table is only read-locked.
+type EvictionPolicy interface {
+	// Added is called when key gets added to the table or its item replaced.
+	Added(key interface{})
+	// Accessed is called when key is retrieved via Value.
+	Accessed(key interface{})
+	// Removed is called once key has been removed from the table.
+	Removed(key interface{})
+	// Victim returns the key which should be evicted next. It returns false
+	// if the policy does not track any keys.
+	Victim() (interface{}, bool)
+	// Reset forgets all tracked keys.
+	Reset()
+}
+
+// lruPolicy evicts the least recently used key.
+type lruPolicy struct {
+	sync.Mutex
+	ll    *list.List
+	elems map[interface{}]*list.Element
+}
+
+// NewLRUPolicy returns an EvictionPolicy evicting the least recently used
+// (added or accessed) item first.
+func NewLRUPolicy() EvictionPolicy {
+	return &lruPolicy{
+		ll:    list.New(),
+		elems: make(map[interface{}]*list.Element),
+	}
+}
+
+func (p *lruPolicy) Added(key interface{}) {
+	p.Lock()
+	defer p.Unlock()
+	if e, ok := p.elems[key]; ok {
+		p.ll.MoveToFront(e)
+		return
+	}
+	p.elems[key] = p.ll.PushFront(key)
+}
+
+func (p *lruPolicy) Accessed(key interface{}) {
+	p.Lock()
+	defer p.Unlock()
+	if e, ok := p.elems[key]; ok {
+		p.ll.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy) Removed(key interface{}) {
+	p.Lock()
+	defer p.Unlock()
+	if e, ok := p.elems[key]; ok {
+		p.ll.Remove(e)
+		delete(p.elems, key)
+	}
+}
+
+func (p *lruPolicy) Victim() (interface{}, bool) {
+	p.Lock()
+	defer p.Unlock()
+	e := p.ll.Back()
+	if e == nil {
+		return nil, false
+	}
+	return e.Value, true
+}
+
+func (p *lruPolicy) Reset() {
+	p.Lock()
+	defer p.Unlock()
+	p.ll.Init()
+	p.elems = make(map[interface{}]*list.Element)
+}
+
+// fifoPolicy evicts the oldest key, regardless of how often it was accessed.
+type fifoPolicy struct {
+	lruPolicy
+}
+
+// NewFIFOPolicy returns an EvictionPolicy evicting the item which was added
+// to the table first. Replacing an item does not change its position.
+func NewFIFOPolicy() EvictionPolicy {
+	return &fifoPolicy{
+		lruPolicy: lruPolicy{
+			ll:    list.New(),
+			elems: make(map[interface{}]*list.Element),
+		},
+	}
+}
+
+func (p *fifoPolicy) Added(key interface{}) {
+	p.Lock()
+	defer p.Unlock()
+	if _, ok := p.elems[key]; ok {
+		return
+	}
+	p.elems[key] = p.ll.PushFront(key)
+}
+
+func (p *fifoPolicy) Accessed(key interface{}) {}
+
+// lfuEntry is a key tracked by the lfuPolicy.
+type lfuEntry struct {
+	key   interface{}
+	count int64
+	// seq breaks ties between equally used keys: older ones go first.
+	seq   uint64
+	index int
+}
+
+// lfuHeap is a min-heap of lfuEntries ordered by use count.
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].count == h[j].count {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].count < h[j].count
+}
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*lfuEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
+
+// lfuPolicy evicts the least frequently used key.
+type lfuPolicy struct {
+	sync.Mutex
+	h       lfuHeap
+	entries map[interface{}]*lfuEntry
+	seq     uint64
+}
+
+// NewLFUPolicy returns an EvictionPolicy evicting the least frequently used
+// item first. Ties are broken by evicting the item added earlier.
+func NewLFUPolicy() EvictionPolicy {
+	return &lfuPolicy{
+		entries: make(map[interface{}]*lfuEntry),
+	}
+}
+
+func (p *lfuPolicy) touch(key interface{}, add bool) {
+	if e, ok := p.entries[key]; ok {
+		e.count++
+		heap.Fix(&p.h, e.index)
+		return
+	}
+	if !add {
+		return
+	}
+	p.seq++
+	e := &lfuEntry{key: key, seq: p.seq}
+	p.entries[key] = e
+	heap.Push(&p.h, e)
+}
+
+func (p *lfuPolicy) Added(key interface{}) {
+	p.Lock()
+	defer p.Unlock()
+	p.touch(key, true)
+}
+
+func (p *lfuPolicy) Accessed(key interface{}) {
+	p.Lock()
+	defer p.Unlock()
+	p.touch(key, false)
+}
+
+func (p *lfuPolicy) Removed(key interface{}) {
+	p.Lock()
+	defer p.Unlock()
+	if e, ok := p.entries[key]; ok {
+		heap.Remove(&p.h, e.index)
+		delete(p.entries, key)
+	}
+}
+
+func (p *lfuPolicy) Victim() (interface{}, bool) {
+	p.Lock()
+	defer p.Unlock()
+	if len(p.h) == 0 {
+		return nil, false
+	}
+	return p.h[0].key, true
+}
+
+func (p *lfuPolicy) Reset() {
+	p.Lock()
+	defer p.Unlock()
+	p.h = nil
+	p.entries = make(map[interface{}]*lfuEntry)
+}
+
+// randomPolicy evicts a random key.
+type randomPolicy struct {
+	sync.Mutex
+	keys    []interface{}
+	indices map[interface{}]int
+}
+
+// NewRandomPolicy returns an EvictionPolicy evicting a randomly chosen item.
+func NewRandomPolicy() EvictionPolicy {
+	return &randomPolicy{
+		indices: make(map[interface{}]int),
+	}
+}
+
+func (p *randomPolicy) Added(key interface{}) {
+	p.Lock()
+	defer p.Unlock()
+	if _, ok := p.indices[key]; ok {
+		return
+	}
+	p.indices[key] = len(p.keys)
+	p.keys = append(p.keys, key)
+}
+
+func (p *randomPolicy) Accessed(key interface{}) {}
+
+func (p *randomPolicy) Removed(key interface{}) {
+	p.Lock()
+	defer p.Unlock()
+	i, ok := p.indices[key]
+	if !ok {
+		return
+	}
+	// Move the last key into the freed slot.
+	last := len(p.keys) - 1
+	p.keys[i] = p.keys[last]
+	p.indices[p.keys[i]] = i
+	p.keys[last] = nil
+	p.keys = p.keys[:last]
+	delete(p.indices, key)
+}
+
+func (p *randomPolicy) Victim() (interface{}, bool) {
+	p.Lock()
+	defer p.Unlock()
+	if len(p.keys) == 0 {
+		return nil, false
+	}
+	// #nosec G404 -- eviction does not need a secure random source.
+	return p.keys[rand.Intn(len(p.keys))], true
+}
+
+func (p *randomPolicy) Reset() {
+	p.Lock()
+	defer p.Unlock()
+	p.keys = nil
+	p.indices = make(map[interface{}]int)
+}
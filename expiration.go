@@ -0,0 +1,82 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expirationHeap is a min-heap of expiring items, ordered by the deadline
+// recorded in their expiresAt field. Items without a lifespan never enter it.
+// Stale items are ordered by the end of their grace period instead.
+//
+// KeepAlive only ever moves an item's deadline further into the future, so
+// instead of touching the heap on every access, expirationCheck compares the
+// recorded deadline with the item's current one once it reaches the top, and
+// pushes it back down if it has been kept alive in the meantime.
+//
+// Careful: the heap is guarded by the table-mutex.
+type expirationHeap []*CacheItem
+
+func (h expirationHeap) Len() int           { return len(h) }
+func (h expirationHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h expirationHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *expirationHeap) Push(x interface{}) {
+	item := x.(*CacheItem)
+	item.heapIndex = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expirationHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.heapIndex = -1
+	*h = old[:n-1]
+	return item
+}
+
+// schedule adds item to the heap, if it expires at all.
+func (h *expirationHeap) schedule(item *CacheItem) {
+	deadline := item.expiry()
+	if deadline.IsZero() {
+		return
+	}
+	item.expiresAt = deadline
+	heap.Push(h, item)
+}
+
+// unschedule removes item from the heap, if it is part of it.
+func (h *expirationHeap) unschedule(item *CacheItem) {
+	if item.heapIndex < 0 {
+		return
+	}
+	heap.Remove(h, item.heapIndex)
+}
+
+// next returns the item expiring next, after bringing the top of the heap up
+// to date with the current deadlines of kept alive items.
+func (h *expirationHeap) next(now time.Time) *CacheItem {
+	for len(*h) > 0 {
+		item := (*h)[0]
+		deadline := item.expiry()
+		if !deadline.After(now) || deadline.Equal(item.expiresAt) {
+			return item
+		}
+		item.expiresAt = deadline
+		heap.Fix(h, 0)
+	}
+	return nil
+}
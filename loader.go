@@ -0,0 +1,188 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+)
+
+// loadCall is a data-loader call in flight. All goroutines trying to load the
+// same key wait for the same call instead of invoking the loader themselves.
+type loadCall struct {
+	// Closed once item and err are set.
+	done chan struct{}
+	// The loaded item as stored in the table, or the error.
+	item *CacheItem
+	err  error
+	// Set if the data-loader panicked, re-raised in all waiting goroutines.
+	panicked *LoaderPanic
+
+	// Number of goroutines waiting for the call, guarded by table.loadMutex.
+	waiters int
+	// Cancels the context passed to the data-loader.
+	cancel context.CancelFunc
+}
+
+// detachedContext carries the values of its parent, but is never done. The
+// data-loader gets passed such a context, so it keeps running for the other
+// waiters when the goroutine which started it gives up.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// load fetches key via the data-loader f and adds it to the table. Concurrent
+// loads of the same key are coalesced into a single call of f, whose result
+// all callers share. The call gets cancelled once all callers gave up.
+// It returns ErrKeyNotFoundOrLoadable if f couldn't find the key, or a
+// LoadError if f or ctx failed.
+func (table *CacheTable) load(ctx context.Context, f func(context.Context, interface{}, ...interface{}) (*CacheItem, error), key interface{}, args ...interface{}) (*CacheItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &LoadError{Key: key, Err: err}
+	}
+
+	table.loadMutex.Lock()
+	c, ok := table.loads[key]
+	if !ok {
+		c = table.startLoad(ctx, f, key, args...)
+	}
+	c.waiters++
+	table.loadMutex.Unlock()
+
+	return table.wait(ctx, c, key)
+}
+
+// startLoad registers a new call of the data-loader f for key and starts it.
+func (table *CacheTable) startLoad(ctx context.Context, f func(context.Context, interface{}, ...interface{}) (*CacheItem, error), key interface{}, args ...interface{}) *loadCall {
+	// Careful: do not run this method unless table.loadMutex is locked!
+	if table.loads == nil {
+		table.loads = make(map[interface{}]*loadCall)
+	}
+	var loadCtx context.Context
+	c := &loadCall{done: make(chan struct{})}
+	loadCtx, c.cancel = context.WithCancel(detachedContext{ctx})
+	table.loads[key] = c
+	go table.runLoad(loadCtx, c, f, key, args...)
+	return c
+}
+
+// wait waits for the data-loader call c loading key to finish, or gives up
+// once ctx is done.
+func (table *CacheTable) wait(ctx context.Context, c *loadCall, key interface{}) (*CacheItem, error) {
+	select {
+	case <-c.done:
+		if c.panicked != nil {
+			panic(c.panicked)
+		}
+		return c.item, c.err
+	case <-ctx.Done():
+		table.loadMutex.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// Nobody is interested in the result anymore.
+			c.cancel()
+			if table.loads[key] == c {
+				delete(table.loads, key)
+			}
+		}
+		table.loadMutex.Unlock()
+		table.log("Gave up loading key", key, "for table", table.name, ":", ctx.Err())
+		return nil, &LoadError{Key: key, Err: ctx.Err()}
+	}
+}
+
+// runLoad invokes the data-loader f for call c.
+func (table *CacheTable) runLoad(ctx context.Context, c *loadCall, f func(context.Context, interface{}, ...interface{}) (*CacheItem, error), key interface{}, args ...interface{}) {
+	defer c.cancel()
+	defer func() {
+		// Don't crash the process from a goroutine nobody can recover in,
+		// let the waiting goroutines panic instead.
+		if r := recover(); r != nil {
+			inc(&table.stats.loaderFailures)
+			c.panicked = &LoaderPanic{Value: r, Stack: debug.Stack()}
+			table.log("Data-loader panicked loading key", key, "for table", table.name, ":", r)
+		}
+
+		table.loadMutex.Lock()
+		if table.loads[key] == c {
+			delete(table.loads, key)
+		}
+		table.loadMutex.Unlock()
+		close(c.done)
+	}()
+
+	inc(&table.stats.loaderCalls)
+	start := time.Now()
+	item, err := f(ctx, key, args...)
+	table.stats.observeLoaderLatency(time.Since(start))
+	switch {
+	case err != nil:
+		inc(&table.stats.loaderFailures)
+		c.err = &LoadError{Key: key, Err: err}
+	case item == nil:
+		inc(&table.stats.loaderFailures)
+		c.err = ErrKeyNotFoundOrLoadable
+		table.addNegative(key)
+	default:
+		c.item = table.AddWithOptions(key, item.data, ItemOptions{
+			LifeSpan: item.lifeSpan,
+			MaxAge:   item.maxAge,
+		})
+	}
+}
+
+// addNegative remembers that key couldn't be loaded, if negative caching is
+// enabled.
+func (table *CacheTable) addNegative(key interface{}) {
+	table.Lock()
+	lifeSpan := table.negativeLifeSpan
+	if _, ok := table.items[key]; ok || lifeSpan <= 0 {
+		// Negative caching is disabled, or the key got added meanwhile.
+		table.Unlock()
+		return
+	}
+
+	table.log("Caching missing key", key, "for", lifeSpan, "in table", table.name)
+	item := table.newItem(key, nil, ItemOptions{MaxAge: lifeSpan})
+	item.negative = true
+	if n, ok := table.negatives[key]; ok {
+		table.deleteNegative(n)
+	}
+	if table.negatives == nil {
+		table.negatives = make(map[interface{}]*CacheItem)
+	}
+	table.negatives[key] = item
+	table.expirations.schedule(item)
+
+	expDur := table.cleanupInterval
+	table.Unlock()
+
+	table.checkExpiration(item, expDur)
+}
+
+// deleteNegative removes the negative entry n.
+func (table *CacheTable) deleteNegative(n *CacheItem) {
+	// Careful: do not run this method unless the table-mutex is locked!
+	table.expirations.unschedule(n)
+	if table.negatives[n.key] == n {
+		delete(table.negatives, n.key)
+	}
+}
+
+// isNegative returns whether the data-loader recently couldn't find key.
+func (table *CacheTable) isNegative(key interface{}) bool {
+	// Careful: do not run this method unless the table-mutex is (read-)locked!
+	n, ok := table.negatives[key]
+	return ok && table.clock.Now().Before(n.deadline())
+}
@@ -0,0 +1,138 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+// Package metrics exposes the statistics of cache2go tables in the Prometheus
+// text exposition format, without depending on the Prometheus client library.
+//
+// Serve all tables of the cache on /metrics:
+//
+//	http.Handle("/metrics", metrics.Handler())
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/muesli/cache2go"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// counter is a family of counters, one per table.
+type counter struct {
+	name  string
+	help  string
+	value func(s cache2go.TableStats) uint64
+}
+
+var counters = []counter{
+	{"cache2go_hits_total", "Number of lookups which found the item in the table.",
+		func(s cache2go.TableStats) uint64 { return s.Hits }},
+	{"cache2go_misses_total", "Number of lookups which didn't find the item in the table.",
+		func(s cache2go.TableStats) uint64 { return s.Misses }},
+	{"cache2go_loader_calls_total", "Number of data-loader invocations.",
+		func(s cache2go.TableStats) uint64 { return s.LoaderCalls }},
+	{"cache2go_loader_failures_total", "Number of data-loader invocations which didn't return an item.",
+		func(s cache2go.TableStats) uint64 { return s.LoaderFailures }},
+	{"cache2go_adds_total", "Number of items added for new keys.",
+		func(s cache2go.TableStats) uint64 { return s.Adds }},
+	{"cache2go_replaces_total", "Number of items replacing an existing item.",
+		func(s cache2go.TableStats) uint64 { return s.Replaces }},
+	{"cache2go_deletes_total", "Number of items removed explicitly.",
+		func(s cache2go.TableStats) uint64 { return s.Deletes }},
+	{"cache2go_expirations_total", "Number of items removed because they expired.",
+		func(s cache2go.TableStats) uint64 { return s.Expirations }},
+	{"cache2go_evictions_total", "Number of items removed to make room for new ones.",
+		func(s cache2go.TableStats) uint64 { return s.Evictions }},
+	{"cache2go_flushes_total", "Number of times the table was flushed.",
+		func(s cache2go.TableStats) uint64 { return s.Flushes }},
+}
+
+// Handler returns an http.Handler serving the metrics of all tables in the
+// cache.
+func Handler() http.Handler {
+	return handler(cache2go.Tables)
+}
+
+// HandlerFor returns an http.Handler serving the metrics of all tables in
+// registry r.
+func HandlerFor(r *cache2go.Registry) http.Handler {
+	return handler(r.Tables)
+}
+
+// handler returns an http.Handler serving the metrics of the tables returned
+// by tables.
+func handler(tables func() []*cache2go.CacheTable) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_ = Write(w, tables())
+	})
+}
+
+// Write writes the metrics of tables to w.
+func Write(w io.Writer, tables []*cache2go.CacheTable) error {
+	bw := bufio.NewWriter(w)
+
+	stats := make([]cache2go.TableStats, len(tables))
+	for i, table := range tables {
+		stats[i] = table.Stats()
+	}
+
+	writeHeader(bw, "cache2go_items", "Number of items currently stored in the table.", "gauge")
+	for _, table := range tables {
+		writeSample(bw, "cache2go_items", table.Name(), "", strconv.Itoa(table.Count()))
+	}
+
+	for _, c := range counters {
+		writeHeader(bw, c.name, c.help, "counter")
+		for i, table := range tables {
+			writeSample(bw, c.name, table.Name(), "", strconv.FormatUint(c.value(stats[i]), 10))
+		}
+	}
+
+	const latency = "cache2go_loader_duration_seconds"
+	writeHeader(bw, latency, "Time spent in data-loader invocations.", "histogram")
+	for _, table := range tables {
+		h := table.LoaderLatency()
+		var cumulative uint64
+		for i, bound := range h.Bounds {
+			cumulative += h.Counts[i]
+			le := strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)
+			writeSample(bw, latency+"_bucket", table.Name(), le, strconv.FormatUint(cumulative, 10))
+		}
+		count := strconv.FormatUint(h.Count(), 10)
+		writeSample(bw, latency+"_bucket", table.Name(), "+Inf", count)
+		writeSample(bw, latency+"_sum", table.Name(), "", strconv.FormatFloat(h.Sum.Seconds(), 'g', -1, 64))
+		writeSample(bw, latency+"_count", table.Name(), "", count)
+	}
+
+	return bw.Flush()
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func writeSample(w *bufio.Writer, name, table, le, value string) {
+	w.WriteString(name + `{table="` + escape(table) + `"`)
+	if le != "" {
+		w.WriteString(`,le="` + le + `"`)
+	}
+	w.WriteString("} " + value + "\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escape escapes a label value.
+func escape(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,53 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muesli/cache2go"
+)
+
+func TestHandler(t *testing.T) {
+	registry := cache2go.NewRegistry()
+	table := registry.Table(`testMetrics "quoted"`)
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *cache2go.CacheItem {
+		time.Sleep(15 * time.Millisecond)
+		return cache2go.NewCacheItem(key, 0, "loaded")
+	})
+	table.Add("a", 0, "value")
+	table.Value("a")
+	table.Value("b")
+
+	rec := httptest.NewRecorder()
+	HandlerFor(registry).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Header().Get("Content-Type") != ContentType {
+		t.Error("Error setting content type:", rec.Header().Get("Content-Type"))
+	}
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE cache2go_items gauge",
+		`cache2go_items{table="testMetrics \"quoted\""} 2`,
+		`cache2go_hits_total{table="testMetrics \"quoted\""} 1`,
+		`cache2go_misses_total{table="testMetrics \"quoted\""} 1`,
+		`cache2go_loader_calls_total{table="testMetrics \"quoted\""} 1`,
+		"# TYPE cache2go_loader_duration_seconds histogram",
+		`cache2go_loader_duration_seconds_bucket{table="testMetrics \"quoted\"",le="0.01"} 0`,
+		`cache2go_loader_duration_seconds_bucket{table="testMetrics \"quoted\"",le="10"} 1`,
+		`cache2go_loader_duration_seconds_bucket{table="testMetrics \"quoted\"",le="+Inf"} 1`,
+		`cache2go_loader_duration_seconds_count{table="testMetrics \"quoted\""} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Error("Missing line in metrics:", line)
+		}
+	}
+}
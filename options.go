@@ -0,0 +1,149 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// DefaultLifeSpan can be passed as the lifeSpan of an item, to let it use the
+// default lifespan of the table it gets added to, see WithDefaultLifeSpan.
+const DefaultLifeSpan time.Duration = -1
+
+// TableOption configures a table before it gets published.
+type TableOption func(*CacheTable)
+
+// NewTable returns a new table with the given name, configured by opts. Unlike
+// Cache, NewTable doesn't register the table, so it's private to the caller.
+func NewTable(name string, opts ...TableOption) *CacheTable {
+	table := newCacheTable(name)
+	for _, opt := range opts {
+		opt(table)
+	}
+	return table
+}
+
+// WithLogger sets the logger to be used by the table.
+func WithLogger(logger *log.Logger) TableOption {
+	return func(table *CacheTable) {
+		table.logger = logger
+	}
+}
+
+// WithLoader configures a data-loader callback, see CacheTable.SetDataLoader.
+func WithLoader(f func(interface{}, ...interface{}) *CacheItem) TableOption {
+	return func(table *CacheTable) {
+		table.SetDataLoader(f)
+	}
+}
+
+// WithLoaderContext configures a context-aware data-loader callback, see
+// CacheTable.SetDataLoaderContext.
+func WithLoaderContext(f func(context.Context, interface{}, ...interface{}) (*CacheItem, error)) TableOption {
+	return func(table *CacheTable) {
+		table.loadData = f
+	}
+}
+
+// WithBatchLoader configures a batch data-loader callback, see
+// CacheTable.SetBatchDataLoader.
+func WithBatchLoader(f func(keys []interface{}) (map[interface{}]*CacheItem, error)) TableOption {
+	return func(table *CacheTable) {
+		table.SetBatchDataLoader(f)
+	}
+}
+
+// WithBatchLoaderContext configures a context-aware batch data-loader
+// callback, see CacheTable.SetBatchDataLoaderContext.
+func WithBatchLoaderContext(f func(ctx context.Context, keys []interface{}) (map[interface{}]*CacheItem, error)) TableOption {
+	return func(table *CacheTable) {
+		table.loadBatch = f
+	}
+}
+
+// WithBatchWindow configures how the batch data-loader collects keys, see
+// CacheTable.SetBatchWindow.
+func WithBatchWindow(maxSize int, maxWait time.Duration) TableOption {
+	return func(table *CacheTable) {
+		table.batchSize = maxSize
+		table.batchWait = maxWait
+	}
+}
+
+// WithNegativeLifeSpan enables negative caching, see
+// CacheTable.SetNegativeLifeSpan.
+func WithNegativeLifeSpan(lifeSpan time.Duration) TableOption {
+	return func(table *CacheTable) {
+		table.negativeLifeSpan = lifeSpan
+	}
+}
+
+// WithMaxEntries limits the table to max items, see CacheTable.SetMaxEntries.
+func WithMaxEntries(max int) TableOption {
+	return func(table *CacheTable) {
+		table.maxEntries = max
+		if max > 0 && table.evictionPolicy == nil {
+			table.setEvictionPolicy(NewLRUPolicy())
+		}
+	}
+}
+
+// WithEvictionPolicy configures the policy used to pick items for eviction.
+func WithEvictionPolicy(policy EvictionPolicy) TableOption {
+	return func(table *CacheTable) {
+		table.setEvictionPolicy(policy)
+	}
+}
+
+// WithEvictionPolicyFunc configures the policy used to pick items for
+// eviction, calling newPolicy to create it. Unlike WithEvictionPolicy, it
+// gives every shard of a ShardedTable its own policy.
+func WithEvictionPolicyFunc(newPolicy func() EvictionPolicy) TableOption {
+	return func(table *CacheTable) {
+		table.setEvictionPolicy(newPolicy())
+	}
+}
+
+// WithDefaultLifeSpan configures the lifespan of items added with a lifespan
+// of DefaultLifeSpan.
+func WithDefaultLifeSpan(lifeSpan time.Duration) TableOption {
+	return func(table *CacheTable) {
+		table.defaultLifeSpan = lifeSpan
+	}
+}
+
+// WithCodec configures the codec used to save and load snapshots.
+func WithCodec(codec Codec) TableOption {
+	return func(table *CacheTable) {
+		table.codec = codec
+	}
+}
+
+// WithAddedItemCallback appends a callback to the addedItem queue.
+func WithAddedItemCallback(f func(*CacheItem)) TableOption {
+	return func(table *CacheTable) {
+		table.addedItem = append(table.addedItem, f)
+	}
+}
+
+// WithAboutToDeleteItemCallback appends a callback to the aboutToDeleteItem
+// queue.
+func WithAboutToDeleteItemCallback(f func(*CacheItem)) TableOption {
+	return func(table *CacheTable) {
+		table.aboutToDeleteItem = append(table.aboutToDeleteItem, f)
+	}
+}
+
+// WithRemovedItemCallback appends a callback to the removedItem queue.
+func WithRemovedItemCallback(f func(*CacheItem, RemovalReason)) TableOption {
+	return func(table *CacheTable) {
+		table.removedItem = append(table.removedItem, f)
+	}
+}
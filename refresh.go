@@ -0,0 +1,115 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"context"
+	"time"
+)
+
+// SetRefreshAhead enables refresh-ahead: when an item gets accessed via Value
+// or ValueMulti while less than the given fraction of its lifespan or max age
+// is left, the data-loader gets invoked in the background to replace it with
+// a fresh one. The current item keeps being served meanwhile, so hot items
+// get refreshed before they expire instead of blocking a caller on the
+// data-loader. A fraction of 0 disables refresh-ahead, 1 refreshes items on
+// every access.
+func (table *CacheTable) SetRefreshAhead(fraction float64) {
+	table.Lock()
+	defer table.Unlock()
+	table.refreshAhead = fraction
+}
+
+// WithRefreshAhead enables refresh-ahead, see CacheTable.SetRefreshAhead.
+func WithRefreshAhead(fraction float64) TableOption {
+	return func(table *CacheTable) {
+		table.refreshAhead = fraction
+	}
+}
+
+// DefaultRefreshRetryInterval is the default minimum time between background
+// reloads of the same item, see CacheTable.SetRefreshRetryInterval.
+const DefaultRefreshRetryInterval = time.Second
+
+// SetRefreshRetryInterval configures the minimum time between background
+// reloads of the same item, which happen for stale items and refresh-ahead.
+// As a successful reload replaces the item, this only limits how often the
+// data-loader gets retried while it keeps failing, instead of invoking it on
+// every access. It defaults to DefaultRefreshRetryInterval, 0 retries on
+// every access.
+func (table *CacheTable) SetRefreshRetryInterval(interval time.Duration) {
+	table.Lock()
+	defer table.Unlock()
+	table.refreshRetry = interval
+}
+
+// WithRefreshRetryInterval configures the minimum time between background
+// reloads of the same item, see CacheTable.SetRefreshRetryInterval.
+func WithRefreshRetryInterval(interval time.Duration) TableOption {
+	return func(table *CacheTable) {
+		table.refreshRetry = interval
+	}
+}
+
+// refreshDue returns whether less than fraction of item's lifespan or max age
+// is left at now.
+func (item *CacheItem) refreshDue(now time.Time, fraction float64) bool {
+	item.RLock()
+	defer item.RUnlock()
+	if item.lifeSpan > 0 && item.accessedOn.Add(item.lifeSpan).Sub(now) < time.Duration(fraction*float64(item.lifeSpan)) {
+		return true
+	}
+	return item.maxAge > 0 && item.createdOn.Add(item.maxAge).Sub(now) < time.Duration(fraction*float64(item.maxAge))
+}
+
+// refresh reloads item in the background, unless it's being loaded already,
+// got replaced meanwhile or was reloaded less than the retry interval ago.
+func (table *CacheTable) refresh(loadData func(context.Context, interface{}, ...interface{}) (*CacheItem, error), loadBatch func(context.Context, []interface{}) (map[interface{}]*CacheItem, error), item *CacheItem, args ...interface{}) {
+	key := item.key
+	table.loadMutex.Lock()
+	defer table.loadMutex.Unlock()
+	if _, loading := table.loads[key]; loading {
+		return
+	}
+	// Loads store their item before they get unregistered, so a refresh
+	// which finished already replaced item by now.
+	table.RLock()
+	current := table.items[key]
+	retry := table.refreshRetry
+	table.RUnlock()
+	if current != item {
+		return
+	}
+	now := table.clock.Now()
+	item.Lock()
+	if now.Before(item.refreshAfter) {
+		// The last reload failed only recently.
+		item.Unlock()
+		return
+	}
+	item.refreshAfter = now.Add(retry)
+	item.Unlock()
+
+	// Register the call right away, so concurrent hits don't start another
+	// refresh. The refresh counts as a waiter which never gives up, so the
+	// call keeps running when other callers waiting for it give up.
+	table.log("Refreshing item with key", key, "in table", table.name)
+	if loadData != nil {
+		table.startLoad(context.Background(), loadData, key, args...).waiters++
+		return
+	}
+	if table.loads == nil {
+		table.loads = make(map[interface{}]*loadCall)
+	}
+	c := &loadCall{done: make(chan struct{}), waiters: 1}
+	table.loads[key] = c
+	table.collect(context.Background(), loadBatch, key, c)
+	if table.batch != nil && table.batchWait <= 0 {
+		table.dispatch(table.batch)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry is a set of named tables. The package-level functions like Cache
+// operate on a default registry shared by the whole process; separate
+// registries keep tables apart, e.g. between tests.
+type Registry struct {
+	mutex  sync.RWMutex
+	tables map[string]*CacheTable
+}
+
+// NewRegistry returns a new, empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		tables: make(map[string]*CacheTable),
+	}
+}
+
+// Table returns the existing table with given name or creates a new one if the
+// table does not exist yet. The options only get applied when creating the
+// table.
+func (r *Registry) Table(name string, opts ...TableOption) *CacheTable {
+	r.mutex.RLock()
+	// tables的类型，是一个用于存CacheTable的map
+	t, ok := r.tables[name]
+	r.mutex.RUnlock()
+
+	if !ok {
+		// 如果表不存在的时候需要创建一个空表，这时候同时做了一个读写锁和二次检查，为的是并发安全
+		r.mutex.Lock()
+		t, ok = r.tables[name]
+		// Double check whether the table exists or not.
+		if !ok {
+			t = NewTable(name, opts...)
+			r.tables[name] = t
+		}
+		r.mutex.Unlock()
+	}
+
+	return t
+}
+
+// Drop removes the table with the given name from the registry and stops its
+// expiration checks. It returns false if there was no such table. The items
+// of the table are left alone, but the table must not be used anymore.
+func (r *Registry) Drop(name string) bool {
+	r.mutex.Lock()
+	t, ok := r.tables[name]
+	delete(r.tables, name)
+	r.mutex.Unlock()
+
+	if ok {
+		t.close()
+	}
+	return ok
+}
+
+// Tables returns all tables in the registry, sorted by name.
+func (r *Registry) Tables() []*CacheTable {
+	r.mutex.RLock()
+	tables := make([]*CacheTable, 0, len(r.tables))
+	for _, t := range r.tables {
+		tables = append(tables, t)
+	}
+	r.mutex.RUnlock()
+
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].name < tables[j].name
+	})
+	return tables
+}
+
+// Close drops all tables, stopping their expiration checks. The registry stays
+// usable and creates new tables afterwards.
+func (r *Registry) Close() {
+	r.mutex.Lock()
+	tables := r.tables
+	r.tables = make(map[string]*CacheTable)
+	r.mutex.Unlock()
+
+	for _, t := range tables {
+		t.close()
+	}
+}
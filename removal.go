@@ -0,0 +1,107 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+// RemovalReason describes why an item got removed from a table.
+type RemovalReason int
+
+const (
+	// RemovalExplicit means the item was removed via Delete.
+	RemovalExplicit RemovalReason = iota
+	// RemovalExpired means the item exceeded its lifespan.
+	RemovalExpired
+	// RemovalEvicted means the item was removed to make room for another one.
+	RemovalEvicted
+	// RemovalReplaced means another item was added for the same key.
+	RemovalReplaced
+	// RemovalFlushed means the table was flushed.
+	RemovalFlushed
+)
+
+func (r RemovalReason) String() string {
+	switch r {
+	case RemovalExplicit:
+		return "explicit"
+	case RemovalExpired:
+		return "expired"
+	case RemovalEvicted:
+		return "evicted"
+	case RemovalReplaced:
+		return "replaced"
+	case RemovalFlushed:
+		return "flushed"
+	}
+	return "unknown"
+}
+
+// SetRemovedItemCallback configures a callback, which will be called every
+// time an item gets removed from the cache, along with the reason for its
+// removal. Unlike the AboutToDeleteItem callbacks, it also gets called for
+// items replaced by Add and items dropped by Flush.
+func (table *CacheTable) SetRemovedItemCallback(f func(*CacheItem, RemovalReason)) {
+	if len(table.removedItem) > 0 {
+		table.RemoveRemovedItemCallbacks()
+	}
+	table.Lock()
+	defer table.Unlock()
+	table.removedItem = append(table.removedItem, f)
+}
+
+// AddRemovedItemCallback appends a new callback to the removedItem queue.
+func (table *CacheTable) AddRemovedItemCallback(f func(*CacheItem, RemovalReason)) {
+	table.Lock()
+	defer table.Unlock()
+	table.removedItem = append(table.removedItem, f)
+}
+
+// RemoveRemovedItemCallbacks empties the removed item callback queue.
+func (table *CacheTable) RemoveRemovedItemCallbacks() {
+	table.Lock()
+	defer table.Unlock()
+	table.removedItem = nil
+}
+
+// SetRemovedCallback configures a callback, which will be called when the
+// item gets removed from the cache, along with the reason for its removal.
+func (item *CacheItem) SetRemovedCallback(f func(key interface{}, reason RemovalReason)) {
+	if len(item.removed) > 0 {
+		item.RemoveRemovedCallbacks()
+	}
+	item.Lock()
+	defer item.Unlock()
+	item.removed = append(item.removed, f)
+}
+
+// AddRemovedCallback appends a new callback to the removed queue.
+func (item *CacheItem) AddRemovedCallback(f func(key interface{}, reason RemovalReason)) {
+	item.Lock()
+	defer item.Unlock()
+	item.removed = append(item.removed, f)
+}
+
+// RemoveRemovedCallbacks empties the removed callback queue.
+func (item *CacheItem) RemoveRemovedCallbacks() {
+	item.Lock()
+	defer item.Unlock()
+	item.removed = nil
+}
+
+// notifyRemoved runs the table's removedItem callbacks and the item's removed
+// callbacks for item. The table-mutex must not be locked.
+func notifyRemoved(removedItem []func(*CacheItem, RemovalReason), item *CacheItem, reason RemovalReason) {
+	for _, callback := range removedItem {
+		callback(item, reason)
+	}
+
+	item.RLock()
+	removed := item.removed
+	item.RUnlock()
+	for _, callback := range removed {
+		callback(item.key, reason)
+	}
+}
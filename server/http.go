@@ -0,0 +1,411 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muesli/cache2go"
+)
+
+const (
+	// defaultMostAccessed is the number of items listed by most-accessed,
+	// unless the request asks for another number.
+	defaultMostAccessed = 10
+	// maxBodySize is the maximum size of a request body.
+	maxBodySize = 16 * 1024 * 1024
+)
+
+// ValueEncoder converts item data to and from JSON, as served by the HTTP API.
+type ValueEncoder interface {
+	// EncodeValue returns the JSON representation of data.
+	EncodeValue(data interface{}) (json.RawMessage, error)
+	// DecodeValue returns the data to be stored for the JSON value raw.
+	DecodeValue(raw json.RawMessage) (interface{}, error)
+}
+
+// JSONEncoder is the default ValueEncoder. It marshals data with
+// encoding/json and stores values sent by clients as the interface{} values
+// encoding/json unmarshals them to.
+type JSONEncoder struct{}
+
+// EncodeValue returns the JSON representation of data.
+func (JSONEncoder) EncodeValue(data interface{}) (json.RawMessage, error) {
+	return json.Marshal(data)
+}
+
+// DecodeValue unmarshals raw.
+func (JSONEncoder) DecodeValue(raw json.RawMessage) (interface{}, error) {
+	var data interface{}
+	err := json.Unmarshal(raw, &data)
+	return data, err
+}
+
+// BytesEncoder is a ValueEncoder for tables storing raw bytes, like those
+// served via the memcached and Redis protocols. Values are represented as JSON
+// strings and stored as []byte.
+type BytesEncoder struct{}
+
+// EncodeValue returns data as a JSON string.
+func (BytesEncoder) EncodeValue(data interface{}) (json.RawMessage, error) {
+	switch d := data.(type) {
+	case *memcachedEntry:
+		return json.Marshal(string(d.value))
+	case []byte:
+		return json.Marshal(string(d))
+	case string:
+		return json.Marshal(d)
+	default:
+		return json.Marshal(fmt.Sprint(d))
+	}
+}
+
+// DecodeValue expects raw to be a JSON string and returns its bytes.
+func (BytesEncoder) DecodeValue(raw json.RawMessage) (interface{}, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+// HTTPHandler is an http.Handler exposing the tables of the cache via a JSON
+// API. Items are addressed by string keys. It serves the following endpoints:
+//
+//	GET    /tables                          lists all tables
+//	GET    /tables/{table}                  returns the count and stats of a table
+//	POST   /tables/{table}/flush            flushes a table
+//	GET    /tables/{table}/most-accessed?n= lists the most accessed items
+//	GET    /tables/{table}/items/{key}      returns an item and its metadata
+//	PUT    /tables/{table}/items/{key}      adds an item
+//	DELETE /tables/{table}/items/{key}      deletes an item
+//
+// Tables have to be created via the registry, requests for unknown tables
+// fail with 404 Not Found.
+// Use http.StripPrefix to serve the API below another path.
+type HTTPHandler struct {
+	mu       sync.RWMutex
+	encoders map[string]ValueEncoder
+	registry *cache2go.Registry
+}
+
+// httpTable is the JSON representation of a table.
+type httpTable struct {
+	Name     string               `json:"name"`
+	Count    int                  `json:"count"`
+	Stats    *cache2go.TableStats `json:"stats,omitempty"`
+	HitRatio *float64             `json:"hitRatio,omitempty"`
+}
+
+// httpItem is the JSON representation of an item.
+type httpItem struct {
+	Key         string          `json:"key"`
+	Value       json.RawMessage `json:"value,omitempty"`
+	CreatedOn   time.Time       `json:"createdOn"`
+	AccessedOn  time.Time       `json:"accessedOn"`
+	AccessCount int64           `json:"accessCount"`
+	LifeSpan    string          `json:"lifeSpan"`
+	MaxAge      string          `json:"maxAge"`
+	ExpiresOn   *time.Time      `json:"expiresOn,omitempty"`
+}
+
+// httpPut is the body of a PUT request. LifeSpan and MaxAge are durations as
+// understood by time.ParseDuration.
+type httpPut struct {
+	Value    json.RawMessage `json:"value"`
+	LifeSpan string          `json:"lifeSpan"`
+	MaxAge   string          `json:"maxAge"`
+}
+
+// NewHTTPHandler returns a handler serving the HTTP API.
+func NewHTTPHandler() *HTTPHandler {
+	return &HTTPHandler{}
+}
+
+// SetValueEncoder configures the encoder used for the values of the table with
+// the given name. Tables without an encoder use JSONEncoder.
+func (h *HTTPHandler) SetValueEncoder(table string, enc ValueEncoder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.encoders == nil {
+		h.encoders = make(map[string]ValueEncoder)
+	}
+	h.encoders[table] = enc
+}
+
+// SetRegistry configures the registry whose tables get served. By default the
+// handler serves the tables returned by cache2go.Cache.
+func (h *HTTPHandler) SetRegistry(r *cache2go.Registry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.registry = r
+}
+
+// allTables returns all served tables.
+func (h *HTTPHandler) allTables() []*cache2go.CacheTable {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return registryTables(h.registry)
+}
+
+// encoder returns the encoder for the values of table.
+func (h *HTTPHandler) encoder(table string) ValueEncoder {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if enc, ok := h.encoders[table]; ok {
+		return enc
+	}
+	return JSONEncoder{}
+}
+
+// ServeHTTP routes a request to its endpoint.
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var path []string
+	for _, p := range strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/") {
+		s, err := url.PathUnescape(p)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		path = append(path, s)
+	}
+
+	switch {
+	case len(path) == 1 && path[0] == "tables":
+		if allow(w, r, http.MethodGet) {
+			h.tables(w)
+		}
+	case len(path) < 2 || path[0] != "tables":
+		httpError(w, http.StatusNotFound, errors.New("not found"))
+	case len(path) == 2:
+		if allow(w, r, http.MethodGet) {
+			h.table(w, path[1])
+		}
+	case len(path) == 3 && path[2] == "flush":
+		if allow(w, r, http.MethodPost) {
+			h.flush(w, path[1])
+		}
+	case len(path) == 3 && path[2] == "most-accessed":
+		if allow(w, r, http.MethodGet) {
+			h.mostAccessed(w, r, path[1])
+		}
+	case len(path) >= 4 && path[2] == "items":
+		// Keys may contain escaped as well as unescaped slashes.
+		key := strings.Join(path[3:], "/")
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			h.getItem(w, path[1], key)
+		case http.MethodPut:
+			h.putItem(w, r, path[1], key)
+		case http.MethodDelete:
+			h.deleteItem(w, path[1], key)
+		default:
+			allow(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+		}
+	default:
+		httpError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// allow checks whether the request uses one of the given methods. If not, it
+// responds with an error and returns false.
+func allow(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m || (r.Method == http.MethodHead && m == http.MethodGet) {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	httpError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	return false
+}
+
+// writeJSON responds with v.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// httpError responds with err.
+func httpError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+// lookup returns the table with the given name, without creating it.
+func (h *HTTPHandler) lookup(w http.ResponseWriter, name string) *cache2go.CacheTable {
+	for _, t := range h.allTables() {
+		if t.Name() == name {
+			return t
+		}
+	}
+	httpError(w, http.StatusNotFound, fmt.Errorf("table %q not found", name))
+	return nil
+}
+
+func (h *HTTPHandler) tables(w http.ResponseWriter) {
+	tables := []httpTable{}
+	for _, t := range h.allTables() {
+		tables = append(tables, httpTable{Name: t.Name(), Count: t.Count()})
+	}
+	writeJSON(w, http.StatusOK, tables)
+}
+
+func (h *HTTPHandler) table(w http.ResponseWriter, name string) {
+	t := h.lookup(w, name)
+	if t == nil {
+		return
+	}
+	stats := t.Stats()
+	ratio := stats.HitRatio()
+	writeJSON(w, http.StatusOK, httpTable{
+		Name:     t.Name(),
+		Count:    t.Count(),
+		Stats:    &stats,
+		HitRatio: &ratio,
+	})
+}
+
+func (h *HTTPHandler) flush(w http.ResponseWriter, name string) {
+	t := h.lookup(w, name)
+	if t == nil {
+		return
+	}
+	t.Flush()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTPHandler) mostAccessed(w http.ResponseWriter, r *http.Request, name string) {
+	n := int64(defaultMostAccessed)
+	if s := r.URL.Query().Get("n"); s != "" {
+		var err error
+		if n, err = strconv.ParseInt(s, 10, 64); err != nil || n < 0 {
+			httpError(w, http.StatusBadRequest, fmt.Errorf("invalid number of items %q", s))
+			return
+		}
+	}
+	t := h.lookup(w, name)
+	if t == nil {
+		return
+	}
+
+	items := []httpItem{}
+	for _, item := range t.MostAccessed(n) {
+		items = append(items, metadata(item))
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+func (h *HTTPHandler) getItem(w http.ResponseWriter, name, key string) {
+	t := h.lookup(w, name)
+	if t == nil {
+		return
+	}
+	// Inspecting an item must neither load it nor count as an access.
+	item, err := t.Peek(key)
+	if err != nil {
+		httpError(w, http.StatusNotFound, err)
+		return
+	}
+	h.writeItem(w, http.StatusOK, name, item)
+}
+
+func (h *HTTPHandler) putItem(w http.ResponseWriter, r *http.Request, name, key string) {
+	// Clients mustn't create tables, just like with GET and DELETE.
+	t := h.lookup(w, name)
+	if t == nil {
+		return
+	}
+
+	var body httpPut
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.Value == nil {
+		httpError(w, http.StatusBadRequest, errors.New("missing value"))
+		return
+	}
+	var opts cache2go.ItemOptions
+	for _, d := range []struct {
+		s string
+		d *time.Duration
+	}{{body.LifeSpan, &opts.LifeSpan}, {body.MaxAge, &opts.MaxAge}} {
+		if d.s == "" {
+			continue
+		}
+		var err error
+		if *d.d, err = time.ParseDuration(d.s); err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	data, err := h.encoder(name).DecodeValue(body.Value)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	item := t.AddWithOptions(key, data, opts)
+	h.writeItem(w, http.StatusOK, name, item)
+}
+
+func (h *HTTPHandler) deleteItem(w http.ResponseWriter, name, key string) {
+	t := h.lookup(w, name)
+	if t == nil {
+		return
+	}
+	if _, err := t.Delete(key); err != nil {
+		httpError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeItem responds with item, including its value.
+func (h *HTTPHandler) writeItem(w http.ResponseWriter, status int, table string, item *cache2go.CacheItem) {
+	value, err := h.encoder(table).EncodeValue(item.Data())
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	m := metadata(item)
+	m.Value = value
+	writeJSON(w, status, m)
+}
+
+// metadata returns the JSON representation of item, without its value.
+func metadata(item *cache2go.CacheItem) httpItem {
+	m := httpItem{
+		Key:         fmt.Sprint(item.Key()),
+		CreatedOn:   item.CreatedOn(),
+		AccessedOn:  item.AccessedOn(),
+		AccessCount: item.AccessCount(),
+		LifeSpan:    item.LifeSpan().String(),
+		MaxAge:      item.MaxAge().String(),
+	}
+	if expiresOn := item.ExpiresOn(); !expiresOn.IsZero() {
+		m.ExpiresOn = &expiresOn
+	}
+	return m
+}
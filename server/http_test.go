@@ -0,0 +1,90 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/muesli/cache2go"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	registry := cache2go.NewRegistry()
+	table := registry.Table("testHTTP")
+	h := NewHTTPHandler()
+	h.SetRegistry(registry)
+	// inspecting items via HTTP doesn't count as access, so access one here
+	table.Add("hot", 0, "x")
+	table.Value("hot")
+	registry.Table("testHTTPBytes")
+	h.SetValueEncoder("testHTTPBytes", BytesEncoder{})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		status   int
+		contains []string
+	}{
+		{"PUT", "/tables/testHTTP/items/foo", `{"value": {"a": 1}, "lifeSpan": "1m"}`, 200,
+			[]string{`"key": "foo"`, `"value": {`, `"a": 1`, `"lifeSpan": "1m0s"`, `"expiresOn"`}},
+		{"GET", "/tables/testHTTP/items/foo", "", 200, []string{`"accessCount": 0`}},
+		{"PUT", "/tables/testHTTP/items/a%2Fb", `{"value": "x"}`, 200, []string{`"key": "a/b"`, `"value": "x"`}},
+		{"PUT", "/tables/testHTTP/items/bad", `{"value": 1, "lifeSpan": "soon"}`, 400, []string{`"error"`}},
+		{"PUT", "/tables/testHTTP/items/bad", `{}`, 400, []string{`missing value`}},
+		{"GET", "/tables/testHTTP/items/missing", "", 404, []string{`"error"`}},
+		{"GET", "/tables", "", 200, []string{`"name": "testHTTP"`}},
+		{"GET", "/tables/testHTTP", "", 200, []string{`"count": 3`, `"Hits": 1`, `"hitRatio"`}},
+		{"GET", "/tables/testHTTP/most-accessed?n=1", "", 200, []string{`"key": "hot"`}},
+		{"GET", "/tables/testHTTP/most-accessed?n=x", "", 400, []string{`"error"`}},
+		{"GET", "/tables/nonexistent", "", 404, []string{`table \"nonexistent\" not found`}},
+		{"DELETE", "/tables/testHTTP/items/foo", "", 204, nil},
+		{"DELETE", "/tables/testHTTP/items/foo", "", 404, nil},
+		{"GET", "/tables/testHTTP/flush", "", 405, nil},
+		{"POST", "/tables/testHTTP/flush", "", 204, nil},
+		{"PUT", "/tables/testHTTPBytes/items/raw", `{"value": "bytes"}`, 200, []string{`"value": "bytes"`}},
+		{"PUT", "/tables/nonexistent/items/foo", `{"value": "x"}`, 404, []string{`table \"nonexistent\" not found`}},
+		{"GET", "/bogus", "", 404, nil},
+	}
+	for _, tt := range tests {
+		rec := do(tt.method, tt.path, tt.body)
+		if rec.Code != tt.status {
+			t.Errorf("Unexpected status for %s %s: %d instead of %d: %s", tt.method, tt.path, rec.Code, tt.status, rec.Body)
+		}
+		for _, s := range tt.contains {
+			if !strings.Contains(rec.Body.String(), s) {
+				t.Errorf("Response to %s %s doesn't contain %s: %s", tt.method, tt.path, s, rec.Body)
+			}
+		}
+	}
+
+	if table.Count() != 0 {
+		t.Error("Error flushing table via HTTP")
+	}
+	item, err := registry.Table("testHTTPBytes").Value("raw")
+	if err != nil || string(item.Data().([]byte)) != "bytes" {
+		t.Error("Error decoding value via custom encoder:", err)
+	}
+	for _, t2 := range registry.Tables() {
+		if t2.Name() == "nonexistent" {
+			t.Error("Error refusing to create table via PUT")
+		}
+	}
+	if rec := do(http.MethodHead, "/tables", ""); rec.Code != 200 {
+		t.Error("Error serving HEAD request:", rec.Code)
+	}
+}
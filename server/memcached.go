@@ -0,0 +1,445 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muesli/cache2go"
+)
+
+const (
+	// Version is the server version reported to clients.
+	Version = "cache2go-1.0"
+
+	// maxKeyLength is the maximum length of a memcached key.
+	maxKeyLength = 250
+	// maxRelativeExptime is the largest exptime memcached treats as a number of
+	// seconds, larger ones are unix timestamps.
+	maxRelativeExptime = 60 * 60 * 24 * 30
+	// maxValueSize is the default maximum size of a value.
+	maxValueSize = 1024 * 1024
+)
+
+// memcachedEntry is the data stored in the table for values set via the
+// memcached protocol.
+type memcachedEntry struct {
+	flags uint32
+	value []byte
+}
+
+// Memcached serves a CacheTable via the memcached text protocol. Commands map
+// onto table methods, with the exptime of a command becoming the item's
+// lifespan and the item's version serving as CAS value. Note that lifespans
+// are sliding, so unlike with memcached every get pushes an item's expiration
+// out again.
+type Memcached struct {
+	table *cache2go.CacheTable
+	l     listeners
+
+	// Serializes all commands modifying the table, so read-modify-write
+	// commands like incr don't race with others.
+	mu sync.Mutex
+
+	started time.Time
+}
+
+// NewMemcached returns a server for the memcached text protocol in front of
+// table.
+func NewMemcached(table *cache2go.CacheTable) *Memcached {
+	return &Memcached{
+		table:   table,
+		started: time.Now(),
+	}
+}
+
+// SetLogger sets the logger to be used by this server. It must be called
+// before the server starts serving.
+func (s *Memcached) SetLogger(logger *log.Logger) {
+	s.l.logger = logger
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections.
+func (s *Memcached) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l and serves them. It always returns a non-nil
+// error, ErrServerClosed after Close was called.
+func (s *Memcached) Serve(l net.Listener) error {
+	return s.l.serve(l, s.handle)
+}
+
+// Close closes all listeners and connections of this server.
+func (s *Memcached) Close() error {
+	return s.l.close()
+}
+
+// handle serves a single connection.
+func (s *Memcached) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err != io.EOF {
+				s.l.log("Error reading from", conn.RemoteAddr(), ":", err)
+			}
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			w.WriteString("ERROR\r\n")
+		} else if !s.dispatch(fields, r, w) {
+			w.Flush()
+			return
+		}
+
+		// Only flush once there are no more pipelined commands to process.
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// dispatch runs a single command. It returns false if the connection should be
+// closed.
+func (s *Memcached) dispatch(fields []string, r *bufio.Reader, w *bufio.Writer) bool {
+	cmd, args := strings.ToLower(fields[0]), fields[1:]
+	switch cmd {
+	case "get", "gets":
+		s.get(args, cmd == "gets", w)
+	case "set", "add", "replace", "cas":
+		return s.store(cmd, args, r, w)
+	case "delete":
+		s.delete(args, w)
+	case "incr", "decr":
+		s.incr(args, cmd == "decr", w)
+	case "touch":
+		s.touch(args, w)
+	case "flush_all":
+		s.flushAll(args, w)
+	case "stats":
+		s.stats(w)
+	case "version":
+		w.WriteString("VERSION " + Version + "\r\n")
+	case "verbosity":
+		reply(w, args, "OK")
+	case "quit":
+		return false
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return true
+}
+
+// reply writes msg, unless the last argument asks for no reply.
+func reply(w *bufio.Writer, args []string, msg string) {
+	if len(args) > 0 && args[len(args)-1] == "noreply" {
+		return
+	}
+	w.WriteString(msg + "\r\n")
+}
+
+func clientError(w *bufio.Writer, msg string) {
+	w.WriteString("CLIENT_ERROR " + msg + "\r\n")
+}
+
+// validKey returns whether key is a valid memcached key.
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// lifeSpan converts a memcached exptime into a lifespan. It returns false if
+// the item expired already.
+func lifeSpan(exptime int64) (time.Duration, bool) {
+	switch {
+	case exptime == 0:
+		return 0, true
+	case exptime < 0:
+		return 0, false
+	case exptime > maxRelativeExptime:
+		d := time.Until(time.Unix(exptime, 0))
+		return d, d > 0
+	}
+	return time.Duration(exptime) * time.Second, true
+}
+
+// entry returns the memcached representation of item's data.
+func entry(item *cache2go.CacheItem) *memcachedEntry {
+	switch d := item.Data().(type) {
+	case *memcachedEntry:
+		return d
+	case []byte:
+		return &memcachedEntry{value: d}
+	case string:
+		return &memcachedEntry{value: []byte(d)}
+	default:
+		return &memcachedEntry{value: []byte(fmt.Sprint(d))}
+	}
+}
+
+func (s *Memcached) get(keys []string, withCAS bool, w *bufio.Writer) {
+	for _, key := range keys {
+		// Unlike the storage commands, retrievals count as hits and keep
+		// items alive, just like with memcached.
+		item, err := s.table.Value(key)
+		if err != nil {
+			continue
+		}
+		e := entry(item)
+		w.WriteString("VALUE " + key + " " + strconv.FormatUint(uint64(e.flags), 10) + " " + strconv.Itoa(len(e.value)))
+		if withCAS {
+			w.WriteString(" " + strconv.FormatUint(item.Version(), 10))
+		}
+		w.WriteString("\r\n")
+		w.Write(e.value)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("END\r\n")
+}
+
+// store handles set, add, replace and cas. It returns false if the connection
+// is out of sync with the client and should be closed.
+func (s *Memcached) store(cmd string, args []string, r *bufio.Reader, w *bufio.Writer) bool {
+	if len(args) < 4 || (cmd == "cas" && len(args) < 5) {
+		w.WriteString("ERROR\r\n")
+		return true
+	}
+	key := args[0]
+	flags, ferr := strconv.ParseUint(args[1], 10, 32)
+	exptime, eerr := strconv.ParseInt(args[2], 10, 64)
+	size, serr := strconv.Atoi(args[3])
+	if serr != nil || size < 0 {
+		clientError(w, "bad data chunk")
+		return false
+	}
+	if size > maxValueSize {
+		clientError(w, "object too large for cache")
+		// Skip the data block, so we stay in sync with the client.
+		_, err := r.Discard(size + 2)
+		return err == nil
+	}
+
+	value := make([]byte, size+2)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return false
+	}
+	if string(value[size:]) != "\r\n" {
+		clientError(w, "bad data chunk")
+		return false
+	}
+	value = value[:size]
+
+	var cas uint64
+	var cerr error
+	if cmd == "cas" {
+		cas, cerr = strconv.ParseUint(args[4], 10, 64)
+	}
+	if !validKey(key) || ferr != nil || eerr != nil || cerr != nil {
+		clientError(w, "bad command line format")
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span, alive := lifeSpan(exptime)
+	if cmd == "cas" {
+		var err error
+		if alive {
+			_, err = s.table.CompareAndSwap(key, cas, span, &memcachedEntry{flags: uint32(flags), value: value})
+		} else {
+			_, err = s.table.CompareAndDelete(key, cas)
+		}
+		switch err {
+		case nil:
+			reply(w, args, "STORED")
+		case cache2go.ErrVersionMismatch:
+			reply(w, args, "EXISTS")
+		default:
+			reply(w, args, "NOT_FOUND")
+		}
+		return true
+	}
+
+	exists := s.table.Exists(key)
+	if (cmd == "add" && exists) || (cmd == "replace" && !exists) {
+		reply(w, args, "NOT_STORED")
+		return true
+	}
+
+	if !alive {
+		// Storing an already expired item just removes the current one.
+		s.table.Delete(key)
+		reply(w, args, "STORED")
+		return true
+	}
+	s.table.Add(key, span, &memcachedEntry{flags: uint32(flags), value: value})
+	reply(w, args, "STORED")
+	return true
+}
+
+func (s *Memcached) delete(args []string, w *bufio.Writer) {
+	if len(args) < 1 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.table.Delete(args[0]); err != nil {
+		reply(w, args, "NOT_FOUND")
+		return
+	}
+	reply(w, args, "DELETED")
+}
+
+func (s *Memcached) incr(args []string, decr bool, w *bufio.Writer) {
+	if len(args) < 2 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		clientError(w, "invalid numeric delta argument")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Reading the counter mustn't load the item, keep it alive or count a hit,
+	// just like with the other storage commands.
+	item, err := s.table.Peek(args[0])
+	if err != nil {
+		reply(w, args, "NOT_FOUND")
+		return
+	}
+	e := entry(item)
+	n, err := strconv.ParseUint(string(e.value), 10, 64)
+	if err != nil {
+		clientError(w, "cannot increment or decrement non-numeric value")
+		return
+	}
+	switch {
+	case !decr:
+		// Overflows wrap around, just like with memcached.
+		n += delta
+	case delta > n:
+		n = 0
+	default:
+		n -= delta
+	}
+
+	value := strconv.FormatUint(n, 10)
+	s.table.Add(args[0], item.LifeSpan(), &memcachedEntry{flags: e.flags, value: []byte(value)})
+	reply(w, args, value)
+}
+
+func (s *Memcached) touch(args []string, w *bufio.Writer) {
+	if len(args) < 2 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		clientError(w, "invalid exptime argument")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Touching neither replaces the item, which would change its CAS value,
+	// nor counts as a get.
+	span, alive := lifeSpan(exptime)
+	if !alive {
+		_, err = s.table.Delete(args[0])
+	} else {
+		_, err = s.table.Touch(args[0], span)
+	}
+	if err != nil {
+		reply(w, args, "NOT_FOUND")
+		return
+	}
+	reply(w, args, "TOUCHED")
+}
+
+func (s *Memcached) flushAll(args []string, w *bufio.Writer) {
+	if len(args) > 0 && args[0] != "noreply" {
+		delay, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			clientError(w, "bad command line format")
+			return
+		}
+		if span, ok := lifeSpan(delay); ok && span > 0 {
+			time.AfterFunc(span, s.table.Flush)
+			reply(w, args, "OK")
+			return
+		}
+	}
+
+	s.table.Flush()
+	reply(w, args, "OK")
+}
+
+func (s *Memcached) stats(w *bufio.Writer) {
+	st := s.table.Stats()
+	now := time.Now()
+
+	s.l.mu.Lock()
+	conns := len(s.l.conns)
+	s.l.mu.Unlock()
+
+	for _, stat := range []struct {
+		name  string
+		value string
+	}{
+		{"pid", strconv.Itoa(os.Getpid())},
+		{"uptime", strconv.FormatInt(int64(now.Sub(s.started)/time.Second), 10)},
+		{"time", strconv.FormatInt(now.Unix(), 10)},
+		{"version", Version},
+		{"curr_connections", strconv.Itoa(conns)},
+		{"curr_items", strconv.Itoa(s.table.Count())},
+		{"total_items", strconv.FormatUint(st.Adds+st.Replaces, 10)},
+		{"cmd_get", strconv.FormatUint(st.Hits+st.Misses, 10)},
+		{"get_hits", strconv.FormatUint(st.Hits, 10)},
+		{"get_misses", strconv.FormatUint(st.Misses, 10)},
+		{"delete_hits", strconv.FormatUint(st.Deletes, 10)},
+		{"expired", strconv.FormatUint(st.Expirations, 10)},
+		{"evictions", strconv.FormatUint(st.Evictions, 10)},
+	} {
+		w.WriteString("STAT " + stat.name + " " + stat.value + "\r\n")
+	}
+	w.WriteString("END\r\n")
+}
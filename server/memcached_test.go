@@ -0,0 +1,152 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package server
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/muesli/cache2go"
+)
+
+// startMemcached serves table on a random local port and returns a connected
+// client.
+func startMemcached(t *testing.T, table *cache2go.CacheTable) (*bufio.ReadWriter, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewMemcached(table)
+	go s.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), func() {
+		conn.Close()
+		s.Close()
+	}
+}
+
+// roundtrip sends cmd and reads the expected number of response lines.
+func roundtrip(t *testing.T, rw *bufio.ReadWriter, cmd string, lines int) string {
+	rw.WriteString(cmd)
+	rw.Flush()
+
+	var r []string
+	for i := 0; i < lines; i++ {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			t.Fatal("Error reading response to", cmd, err)
+		}
+		r = append(r, strings.TrimSuffix(line, "\r\n"))
+	}
+	return strings.Join(r, "|")
+}
+
+func TestMemcached(t *testing.T) {
+	table := cache2go.NewTable("testMemcached")
+	rw, stop := startMemcached(t, table)
+	defer stop()
+
+	// cas reads the CAS value of key via gets.
+	cas := func(key string) string {
+		r := roundtrip(t, rw, "gets "+key+"\r\n", 3)
+		fields := strings.Fields(strings.Split(r, "|")[0])
+		if len(fields) != 5 {
+			t.Fatal("Unexpected response to gets:", r)
+		}
+		return fields[4]
+	}
+	type step struct {
+		cmd      string
+		lines    int
+		expected string
+	}
+	run := func(steps ...step) {
+		for _, tt := range steps {
+			if r := roundtrip(t, rw, tt.cmd, tt.lines); r != tt.expected {
+				t.Errorf("Unexpected response to %q: %q instead of %q", tt.cmd, r, tt.expected)
+			}
+		}
+	}
+
+	run(
+		step{"set foo 42 0 3\r\nbar\r\n", 1, "STORED"},
+		step{"get foo missing\r\n", 3, "VALUE foo 42 3|bar|END"},
+		step{"add foo 0 0 1\r\nx\r\n", 1, "NOT_STORED"},
+		step{"replace missing 0 0 1\r\nx\r\n", 1, "NOT_STORED"},
+		step{"replace foo 7 0 3\r\nbaz\r\n", 1, "STORED"},
+	)
+
+	token := cas("foo")
+	if r := roundtrip(t, rw, "gets foo\r\n", 3); r != "VALUE foo 7 3 "+token+"|baz|END" {
+		t.Error("Unexpected response to gets:", r)
+	}
+	if r := roundtrip(t, rw, "cas foo 7 0 1 0\r\nx\r\n", 1); r != "EXISTS" {
+		t.Error("Error rejecting stale CAS value:", r)
+	}
+	if r := roundtrip(t, rw, "cas foo 7 0 1 "+token+"\r\nx\r\n", 1); r != "STORED" {
+		t.Error("Error storing with current CAS value:", r)
+	}
+	if r := roundtrip(t, rw, "cas missing 0 0 1 "+token+"\r\nx\r\n", 1); r != "NOT_FOUND" {
+		t.Error("Error storing missing key via cas:", r)
+	}
+	token = cas("foo")
+	if r := roundtrip(t, rw, "touch foo 100\r\n", 1); r != "TOUCHED" {
+		t.Error("Error touching item:", r)
+	}
+	if r := cas("foo"); r != token {
+		t.Error("Error keeping CAS value when touching item:", r, token)
+	}
+
+	run(
+		step{"gets foo\r\n", 3, "VALUE foo 7 1 " + token + "|x|END"},
+		step{"set n 0 0 2\r\n10\r\n", 1, "STORED"},
+		step{"incr n 5\r\n", 1, "15"},
+		step{"decr n 20\r\n", 1, "0"},
+		step{"incr foo 1\r\n", 1, "CLIENT_ERROR cannot increment or decrement non-numeric value"},
+		step{"incr missing 1\r\n", 1, "NOT_FOUND"},
+		step{"touch missing 100\r\n", 1, "NOT_FOUND"},
+		step{"delete foo\r\n", 1, "DELETED"},
+		step{"delete foo\r\n", 1, "NOT_FOUND"},
+		step{"set quiet 0 0 1 noreply\r\nq\r\nget quiet\r\n", 3, "VALUE quiet 0 1|q|END"},
+		step{"flush_all\r\n", 1, "OK"},
+		step{"get n\r\n", 1, "END"},
+		step{"bogus\r\n", 1, "ERROR"},
+	)
+
+	// values set by Go code are served as well
+	table.Add("native", 0, "hello")
+	if r := roundtrip(t, rw, "get native\r\n", 3); r != "VALUE native 0 5|hello|END" {
+		t.Error("Error serving value set by Go code:", r)
+	}
+
+	if r := roundtrip(t, rw, "stats\r\n", 14); !strings.Contains(r, "STAT curr_items 1") || !strings.HasSuffix(r, "END") {
+		t.Error("Error serving stats:", r)
+	}
+
+	// incr neither loads nor keeps alive the counter
+	counter := table.Add("counter", 0, "1")
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *cache2go.CacheItem {
+		return cache2go.NewCacheItem(key, 0, "1")
+	})
+	stats := table.Stats()
+	if r := roundtrip(t, rw, "incr counter 1\r\n", 1); r != "2" || counter.AccessCount() != 0 {
+		t.Error("Error incrementing counter without side effects:", r, counter.AccessCount())
+	}
+	if r := roundtrip(t, rw, "incr missing 1\r\n", 1); r != "NOT_FOUND" || table.Exists("missing") {
+		t.Error("Error incrementing missing counter:", r)
+	}
+	if s := table.Stats(); s.Hits != stats.Hits || s.Misses != stats.Misses {
+		t.Error("Error incrementing counter without counting hits and misses:", s)
+	}
+}
@@ -0,0 +1,512 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muesli/cache2go"
+)
+
+const (
+	// maxBulkLength is the maximum length of a bulk string sent by a client.
+	maxBulkLength = 64 * 1024 * 1024
+	// maxArrayLength is the maximum number of arguments of a command.
+	maxArrayLength = 1024 * 1024
+	// DefaultDatabases is the number of databases served by default, just
+	// like with Redis.
+	DefaultDatabases = 16
+)
+
+// errProtocol gets returned when a client sent something we can't parse.
+var errProtocol = errors.New("Protocol error")
+
+// RESP serves cache tables via the Redis serialization protocol, supporting
+// both RESP2 and RESP3 (after a HELLO 3). Every database is a table: database
+// n is the table named prefix+n, selected via SELECT. Expirations set via EX,
+// PX or EXPIRE are absolute, just like with Redis, and become the item's max
+// age. Values get stored as []byte.
+type RESP struct {
+	prefix    string
+	registry  *cache2go.Registry
+	databases int
+	l         listeners
+
+	// Serializes all commands modifying tables, so read-modify-write commands
+	// like SET NX don't race with others.
+	mu sync.Mutex
+}
+
+// respConn is the state of a single client connection.
+type respConn struct {
+	w     *bufio.Writer
+	table *cache2go.CacheTable
+	proto int
+}
+
+// NewRESP returns a server for the Redis serialization protocol, serving the
+// tables whose names start with prefix.
+func NewRESP(prefix string) *RESP {
+	return &RESP{prefix: prefix, databases: DefaultDatabases}
+}
+
+// SetLogger sets the logger to be used by this server. It must be called
+// before the server starts serving.
+func (s *RESP) SetLogger(logger *log.Logger) {
+	s.l.logger = logger
+}
+
+// SetRegistry configures the registry holding the served tables, by default
+// the one used by cache2go.Cache. It must be called before the server starts
+// serving.
+func (s *RESP) SetRegistry(r *cache2go.Registry) {
+	s.registry = r
+}
+
+// SetDatabases configures the number of databases clients can SELECT, which
+// limits the number of tables the server creates. It must be called before
+// the server starts serving.
+func (s *RESP) SetDatabases(n int) {
+	s.databases = n
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections.
+func (s *RESP) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l and serves them. It always returns a non-nil
+// error, ErrServerClosed after Close was called.
+func (s *RESP) Serve(l net.Listener) error {
+	return s.l.serve(l, s.handle)
+}
+
+// Close closes all listeners and connections of this server.
+func (s *RESP) Close() error {
+	return s.l.close()
+}
+
+// db returns the table backing database n.
+func (s *RESP) db(n int) *cache2go.CacheTable {
+	return registryTable(s.registry, s.prefix+strconv.Itoa(n))
+}
+
+// handle serves a single connection.
+func (s *RESP) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	c := &respConn{
+		w:     bufio.NewWriter(conn),
+		table: s.db(0),
+		proto: 2,
+	}
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if err == errProtocol {
+				c.error("ERR " + err.Error())
+				c.w.Flush()
+			} else if err != io.EOF {
+				s.l.log("Error reading from", conn.RemoteAddr(), ":", err)
+			}
+			return
+		}
+		if len(args) > 0 && !s.dispatch(c, args) {
+			c.w.Flush()
+			return
+		}
+
+		// Only flush once there are no more pipelined commands to process.
+		if r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readCommand reads a command, either sent as an array of bulk strings or as
+// an inline command.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] != '*' {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(line), nil
+	}
+
+	n, err := readLength(r, '*', maxArrayLength)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		size, err := readLength(r, '$', maxBulkLength)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if string(buf[size:]) != "\r\n" {
+			return nil, errProtocol
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a line and strips its line ending.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readLength reads a line like "*3" or "$5" and returns the length.
+func readLength(r *bufio.Reader, prefix byte, max int) (int, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return 0, err
+	}
+	if len(line) < 2 || line[0] != prefix {
+		return 0, errProtocol
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > max {
+		return 0, errProtocol
+	}
+	return n, nil
+}
+
+func (c *respConn) simple(s string) {
+	c.w.WriteString("+" + s + "\r\n")
+}
+
+func (c *respConn) error(s string) {
+	c.w.WriteString("-" + s + "\r\n")
+}
+
+func (c *respConn) integer(n int64) {
+	c.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (c *respConn) bulk(b []byte) {
+	c.w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	c.w.Write(b)
+	c.w.WriteString("\r\n")
+}
+
+func (c *respConn) null() {
+	if c.proto >= 3 {
+		c.w.WriteString("_\r\n")
+		return
+	}
+	c.w.WriteString("$-1\r\n")
+}
+
+func (c *respConn) array(n int) {
+	c.w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// dict starts a map of n pairs, which RESP2 clients receive as a flat array.
+func (c *respConn) dict(n int) {
+	if c.proto >= 3 {
+		c.w.WriteString("%" + strconv.Itoa(n) + "\r\n")
+		return
+	}
+	c.array(2 * n)
+}
+
+// arity checks the number of arguments of a command.
+func (c *respConn) arity(args []string, min, max int) bool {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		c.error("ERR wrong number of arguments for '" + strings.ToLower(args[0]) + "' command")
+		return false
+	}
+	return true
+}
+
+// dispatch runs a single command. It returns false if the connection should be
+// closed.
+func (s *RESP) dispatch(c *respConn, args []string) bool {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		if c.arity(args, 1, 2) {
+			if len(args) == 2 {
+				c.bulk([]byte(args[1]))
+			} else {
+				c.simple("PONG")
+			}
+		}
+	case "ECHO":
+		if c.arity(args, 2, 2) {
+			c.bulk([]byte(args[1]))
+		}
+	case "HELLO":
+		s.hello(c, args)
+	case "SELECT":
+		if c.arity(args, 2, 2) {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 0 || n >= s.databases {
+				c.error("ERR DB index is out of range")
+				break
+			}
+			c.table = s.db(n)
+			c.simple("OK")
+		}
+	case "GET":
+		if c.arity(args, 2, 2) {
+			s.get(c, args[1])
+		}
+	case "SET":
+		if c.arity(args, 3, -1) {
+			s.set(c, args)
+		}
+	case "DEL":
+		if c.arity(args, 2, -1) {
+			s.mu.Lock()
+			var n int64
+			for _, key := range args[1:] {
+				if _, err := c.table.Delete(key); err == nil {
+					n++
+				}
+			}
+			s.mu.Unlock()
+			c.integer(n)
+		}
+	case "EXISTS":
+		if c.arity(args, 2, -1) {
+			var n int64
+			for _, key := range args[1:] {
+				if c.table.Exists(key) {
+					n++
+				}
+			}
+			c.integer(n)
+		}
+	case "TTL", "PTTL":
+		if c.arity(args, 2, 2) {
+			s.ttl(c, args)
+		}
+	case "EXPIRE", "PEXPIRE":
+		if c.arity(args, 3, 3) {
+			s.expire(c, args)
+		}
+	case "PERSIST":
+		if c.arity(args, 2, 2) {
+			s.persist(c, args[1])
+		}
+	case "DBSIZE":
+		if c.arity(args, 1, 1) {
+			c.integer(int64(c.table.Count()))
+		}
+	case "FLUSHDB":
+		if c.arity(args, 1, 2) {
+			c.table.Flush()
+			c.simple("OK")
+		}
+	case "COMMAND":
+		// Clients like redis-cli ask for command docs, we don't have any.
+		c.array(0)
+	case "QUIT":
+		c.simple("OK")
+		return false
+	default:
+		c.error("ERR unknown command '" + args[0] + "'")
+	}
+	return true
+}
+
+func (s *RESP) hello(c *respConn, args []string) {
+	proto := c.proto
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 2 || n > 3 {
+			c.error("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = n
+	}
+	c.proto = proto
+
+	c.dict(4)
+	c.bulk([]byte("server"))
+	c.bulk([]byte("cache2go"))
+	c.bulk([]byte("version"))
+	c.bulk([]byte(Version))
+	c.bulk([]byte("proto"))
+	c.integer(int64(proto))
+	c.bulk([]byte("mode"))
+	c.bulk([]byte("standalone"))
+}
+
+func (s *RESP) get(c *respConn, key string) {
+	item, err := c.table.Value(key)
+	if err != nil {
+		c.null()
+		return
+	}
+	c.bulk(entry(item).value)
+}
+
+func (s *RESP) set(c *respConn, args []string) {
+	key, value := args[1], []byte(args[2])
+	var maxAge time.Duration
+	var nx, xx, keepTTL bool
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX":
+			if i+1 >= len(args) || maxAge != 0 {
+				c.error("ERR syntax error")
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil || n <= 0 {
+				c.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			maxAge = time.Duration(n) * unit
+		default:
+			c.error("ERR syntax error")
+			return
+		}
+	}
+	if (nx && xx) || (keepTTL && maxAge != 0) {
+		c.error("ERR syntax error")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Checking the key mustn't load the item, keep it alive or count a hit.
+	old, err := c.table.Peek(key)
+	exists := err == nil
+	if (nx && exists) || (xx && !exists) {
+		c.null()
+		return
+	}
+
+	opts := cache2go.ItemOptions{MaxAge: maxAge}
+	if keepTTL && exists {
+		opts = remaining(old)
+	}
+	c.table.AddWithOptions(key, value, opts)
+	c.simple("OK")
+}
+
+// remaining returns options letting a new item expire when old would have.
+func remaining(old *cache2go.CacheItem) cache2go.ItemOptions {
+	opts := cache2go.ItemOptions{LifeSpan: old.LifeSpan()}
+	if old.MaxAge() > 0 {
+		opts.MaxAge = time.Until(old.CreatedOn().Add(old.MaxAge()))
+		if opts.MaxAge <= 0 {
+			opts.MaxAge = time.Nanosecond
+		}
+	}
+	return opts
+}
+
+func (s *RESP) ttl(c *respConn, args []string) {
+	// Don't load the item, keep it alive or count a hit, just like Redis.
+	item, err := c.table.Peek(args[1])
+	if err != nil {
+		c.integer(-2)
+		return
+	}
+	expiresOn := item.ExpiresOn()
+	if expiresOn.IsZero() {
+		c.integer(-1)
+		return
+	}
+
+	d := time.Until(expiresOn)
+	if d < 0 {
+		d = 0
+	}
+	if strings.ToUpper(args[0]) == "PTTL" {
+		c.integer(int64((d + time.Millisecond/2) / time.Millisecond))
+		return
+	}
+	c.integer(int64((d + time.Second/2) / time.Second))
+}
+
+func (s *RESP) expire(c *respConn, args []string) {
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		c.error("ERR value is not an integer or out of range")
+		return
+	}
+	unit := time.Second
+	if strings.ToUpper(args[0]) == "PEXPIRE" {
+		unit = time.Millisecond
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, err := c.table.Peek(args[1])
+	if err != nil {
+		c.integer(0)
+		return
+	}
+	if n <= 0 {
+		c.table.Delete(args[1])
+	} else {
+		c.table.AddWithOptions(args[1], item.Data(), cache2go.ItemOptions{
+			LifeSpan: item.LifeSpan(),
+			MaxAge:   time.Duration(n) * unit,
+		})
+	}
+	c.integer(1)
+}
+
+func (s *RESP) persist(c *respConn, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, err := c.table.Peek(key)
+	if err != nil || item.ExpiresOn().IsZero() {
+		c.integer(0)
+		return
+	}
+	c.table.Add(key, 0, item.Data())
+	c.integer(1)
+}
@@ -0,0 +1,108 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package server
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/muesli/cache2go"
+)
+
+func TestRESP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := cache2go.NewRegistry()
+	s := NewRESP("testRESP")
+	s.SetRegistry(registry)
+	go s.Serve(l)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+
+	tests := []struct {
+		cmd      string
+		lines    int
+		expected string
+	}{
+		{"PING\r\n", 1, "+PONG"},
+		{"*3\r\n$3\r\nSET\r\n$3\r\nfoo\r\n$3\r\nbar\r\n", 1, "+OK"},
+		{"*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n", 2, "$3|bar"},
+		{"GET missing\r\n", 1, "$-1"},
+		{"SET foo baz NX\r\n", 1, "$-1"},
+		{"SET missing baz XX\r\n", 1, "$-1"},
+		{"SET foo baz XX EX 100\r\n", 1, "+OK"},
+		{"TTL foo\r\n", 1, ":100"},
+		{"PERSIST foo\r\n", 1, ":1"},
+		{"TTL foo\r\n", 1, ":-1"},
+		{"PERSIST foo\r\n", 1, ":0"},
+		{"EXPIRE foo 50\r\n", 1, ":1"},
+		{"PTTL foo\r\n", 1, ":50000"},
+		{"EXPIRE missing 50\r\n", 1, ":0"},
+		{"TTL missing\r\n", 1, ":-2"},
+		{"SET n 1 PX 0\r\n", 1, "-ERR invalid expire time in 'set' command"},
+		{"SET n 1\r\n", 1, "+OK"},
+		{"EXISTS foo n missing\r\n", 1, ":2"},
+		{"DBSIZE\r\n", 1, ":2"},
+		{"DEL foo missing\r\n", 1, ":1"},
+		{"SELECT 16\r\n", 1, "-ERR DB index is out of range"},
+		{"SELECT 1\r\n", 1, "+OK"},
+		{"DBSIZE\r\n", 1, ":0"},
+		{"SET other 1\r\n", 1, "+OK"},
+		{"SELECT 0\r\n", 1, "+OK"},
+		{"FLUSHDB\r\n", 1, "+OK"},
+		{"DBSIZE\r\n", 1, ":0"},
+		{"GET\r\n", 1, "-ERR wrong number of arguments for 'get' command"},
+		{"BOGUS\r\n", 1, "-ERR unknown command 'BOGUS'"},
+		{"HELLO 4\r\n", 1, "-NOPROTO unsupported protocol version"},
+		{"HELLO 3\r\n", 16, "%4|$6|server|$8|cache2go|$7|version|$12|" + Version + "|$5|proto|:3|$4|mode|$10|standalone"},
+		{"GET missing\r\n", 1, "_"},
+	}
+	for _, tt := range tests {
+		if r := roundtrip(t, rw, tt.cmd, tt.lines); r != tt.expected {
+			t.Errorf("Unexpected response to %q: %q instead of %q", tt.cmd, r, tt.expected)
+		}
+	}
+	if !registry.Table("testRESP1").Exists("other") {
+		t.Error("Error selecting table via SELECT")
+	}
+
+	// TTL neither keeps items alive nor loads them
+	table := registry.Table("testRESP0")
+	item := table.Add("native", time.Minute, []byte("v"))
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *cache2go.CacheItem {
+		return cache2go.NewCacheItem(key, 0, []byte("loaded"))
+	})
+	if r := roundtrip(t, rw, "TTL native\r\n", 1); r != ":60" || item.AccessCount() != 0 {
+		t.Error("Error reading TTL without side effects:", r, item.AccessCount())
+	}
+	if r := roundtrip(t, rw, "TTL missing\r\n", 1); r != ":-2" || table.Exists("missing") {
+		t.Error("Error reading TTL of missing key:", r)
+	}
+
+	// neither do the checks of mutating commands
+	stats := table.Stats()
+	for _, cmd := range []string{"SET native v NX\r\n", "SET missing v XX\r\n", "EXPIRE missing 50\r\n", "PERSIST missing\r\n"} {
+		roundtrip(t, rw, cmd, 1)
+	}
+	if item.AccessCount() != 0 || table.Exists("missing") {
+		t.Error("Error checking keys without side effects:", item.AccessCount())
+	}
+	if s := table.Stats(); s.Hits != stats.Hits || s.Misses != stats.Misses {
+		t.Error("Error checking keys without counting hits and misses:", s)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+// Package server makes cache2go tables available to other processes, by
+// speaking network protocols common caches speak, and offers an HTTP API to
+// inspect and manipulate tables at runtime.
+package server
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/muesli/cache2go"
+)
+
+// ErrServerClosed gets returned by Serve and ListenAndServe after Close was
+// called.
+var ErrServerClosed = errors.New("server closed")
+
+// listeners keeps track of the listeners and connections of a server, so they
+// can all be closed at once.
+type listeners struct {
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	logger    *log.Logger
+}
+
+// serve accepts connections on l and handles each of them in its own goroutine.
+func (s *listeners) serve(l net.Listener, handle func(net.Conn)) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				s.log("Accept error:", err)
+				continue
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		go func() {
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			handle(conn)
+		}()
+	}
+}
+
+// close closes all listeners and connections.
+func (s *listeners) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
+
+// Internal logging method for convenience.
+func (s *listeners) log(v ...interface{}) {
+	if s.logger == nil {
+		return
+	}
+
+	s.logger.Println(v...)
+}
+
+// registryTable returns the table with the given name from r, or from the
+// default registry used by cache2go.Cache if r is nil.
+func registryTable(r *cache2go.Registry, name string) *cache2go.CacheTable {
+	if r == nil {
+		return cache2go.Cache(name)
+	}
+	return r.Table(name)
+}
+
+// registryTables returns all tables of r, or of the default registry used by
+// cache2go.Cache if r is nil.
+func registryTables(r *cache2go.Registry) []*cache2go.CacheTable {
+	if r == nil {
+		return cache2go.Tables()
+	}
+	return r.Tables()
+}
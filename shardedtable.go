@@ -0,0 +1,699 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/maphash"
+	"io"
+	"log"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ShardedTable is a table within the cache, which spreads its items across a
+// number of independent CacheTables. Every shard has its own lock, items and
+// expiration timer, so operations on keys in different shards never contend
+// with each other.
+type ShardedTable struct {
+	// The table's name.
+	name string
+	// The shards, their number is always a power of two.
+	shards []*CacheTable
+	// Mask selecting a shard from a key's hash.
+	mask uint64
+	// Seed used to hash keys.
+	seed maphash.Seed
+}
+
+// NewShardedTable returns a new ShardedTable with the given name and number of
+// shards, which gets rounded up to the next power of two. The options get
+// applied to every shard, which then uses them on its own: callbacks and
+// data-loaders only see the items of their shard, and batch data-loaders and
+// batch windows only batch keys of the same shard. There are two exceptions:
+// the limit of WithMaxEntries gets split across the shards just like with
+// SetMaxEntries, and as shards can't share an eviction policy,
+// WithEvictionPolicy gets ignored in favor of the default LRU policy when used
+// with more than one shard. Use WithEvictionPolicyFunc instead, which creates a
+// policy per shard.
+func NewShardedTable(name string, shards int, opts ...TableOption) *ShardedTable {
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+
+	table := &ShardedTable{
+		name:   name,
+		shards: make([]*CacheTable, n),
+		mask:   uint64(n - 1),
+		seed:   maphash.MakeSeed(),
+	}
+	for i := range table.shards {
+		table.shards[i] = NewTable(name+"/"+strconv.Itoa(i), opts...)
+	}
+	if n > 1 && table.shards[0].evictionPolicy != nil && table.shards[0].evictionPolicy == table.shards[1].evictionPolicy {
+		table.shards[0].log("Ignoring eviction policy shared by all shards of table", name)
+		for _, shard := range table.shards {
+			shard.evictionPolicy = nil
+			if shard.maxEntries > 0 {
+				shard.setEvictionPolicy(NewLRUPolicy())
+			}
+		}
+	}
+	if max := table.shards[0].maxEntries; max > 0 {
+		for _, shard := range table.shards {
+			shard.maxEntries = (max + n - 1) / n
+		}
+	}
+	return table
+}
+
+// Name returns the name of this table.
+func (table *ShardedTable) Name() string {
+	// immutable
+	return table.name
+}
+
+// shard returns the shard responsible for key.
+func (table *ShardedTable) shard(key interface{}) *CacheTable {
+	if table.mask == 0 {
+		return table.shards[0]
+	}
+	return table.shards[table.hash(key)&table.mask]
+}
+
+// hash returns a hash of key. Integers, floats, bools and strings get hashed
+// directly. Keys of any other comparable type get hashed by their contents,
+// the same way map lookups compare them, see writeValue.
+func (table *ShardedTable) hash(key interface{}) uint64 {
+	var n uint64
+	switch k := key.(type) {
+	case string:
+		return table.hashString(k)
+	case int:
+		n = uint64(k)
+	case int8:
+		n = uint64(k)
+	case int16:
+		n = uint64(k)
+	case int32:
+		n = uint64(k)
+	case int64:
+		n = uint64(k)
+	case uint:
+		n = uint64(k)
+	case uint8:
+		n = uint64(k)
+	case uint16:
+		n = uint64(k)
+	case uint32:
+		n = uint64(k)
+	case uint64:
+		n = k
+	case uintptr:
+		n = uint64(k)
+	case float32:
+		n = floatBits(float64(k))
+	case float64:
+		n = floatBits(k)
+	case bool:
+		if k {
+			n = 1
+		}
+	default:
+		var h maphash.Hash
+		h.SetSeed(table.seed)
+		writeValue(&h, reflect.ValueOf(key))
+		return h.Sum64()
+	}
+
+	// splitmix64 finalizer, spreading sequential integers across all shards.
+	n ^= n >> 30
+	n *= 0xbf58476d1ce4e5b9
+	n ^= n >> 27
+	n *= 0x94d049bb133111eb
+	n ^= n >> 31
+	return n
+}
+
+// floatBits returns the bits of f, treating 0 and -0 as the same number just
+// like map lookups do.
+func floatBits(f float64) uint64 {
+	if f == 0 {
+		return 0
+	}
+	return math.Float64bits(f)
+}
+
+// writeValue writes v to h, so values which are equal as map keys write the
+// same bytes: pointers and channels by their address, structs and arrays
+// field by field and interfaces by their dynamic value.
+func writeValue(h *maphash.Hash, v reflect.Value) {
+	var n uint64
+	switch v.Kind() {
+	case reflect.Invalid:
+		// A nil interface.
+	case reflect.String:
+		writeUint64(h, uint64(v.Len()))
+		_, _ = h.WriteString(v.String())
+		return
+	case reflect.Bool:
+		if v.Bool() {
+			n = 1
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = uint64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n = v.Uint()
+	case reflect.Float32, reflect.Float64:
+		n = floatBits(v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		writeUint64(h, floatBits(real(c)))
+		n = floatBits(imag(c))
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		n = uint64(v.Pointer())
+	case reflect.Interface:
+		writeValue(h, v.Elem())
+		return
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			writeValue(h, v.Index(i))
+		}
+		return
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			writeValue(h, v.Field(i))
+		}
+		return
+	}
+	writeUint64(h, n)
+}
+
+func writeUint64(h *maphash.Hash, n uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], n)
+	_, _ = h.Write(b[:])
+}
+
+func (table *ShardedTable) hashString(s string) uint64 {
+	var h maphash.Hash
+	h.SetSeed(table.seed)
+	_, _ = h.WriteString(s)
+	return h.Sum64()
+}
+
+// Count returns how many items are currently stored in the cache.
+func (table *ShardedTable) Count() int {
+	n := 0
+	for _, shard := range table.shards {
+		n += shard.Count()
+	}
+	return n
+}
+
+// Foreach all items. Shards are locked one after another, so the iteration is
+// not an atomic snapshot of the whole table.
+func (table *ShardedTable) Foreach(trans func(key interface{}, item *CacheItem)) {
+	for _, shard := range table.shards {
+		shard.Foreach(trans)
+	}
+}
+
+// SetDataLoader configures a data-loader callback, which will be called when
+// trying to access a non-existing key. The key and 0...n additional arguments
+// are passed to the callback function.
+func (table *ShardedTable) SetDataLoader(f func(interface{}, ...interface{}) *CacheItem) {
+	for _, shard := range table.shards {
+		shard.SetDataLoader(f)
+	}
+}
+
+// SetDataLoaderContext configures a context-aware data-loader callback, see
+// CacheTable.SetDataLoaderContext.
+func (table *ShardedTable) SetDataLoaderContext(f func(context.Context, interface{}, ...interface{}) (*CacheItem, error)) {
+	for _, shard := range table.shards {
+		shard.SetDataLoaderContext(f)
+	}
+}
+
+// SetBatchDataLoader configures a batch data-loader callback, see
+// CacheTable.SetBatchDataLoader. Each shard collects its keys separately, so
+// ValueMulti calls it once per shard.
+func (table *ShardedTable) SetBatchDataLoader(f func(keys []interface{}) (map[interface{}]*CacheItem, error)) {
+	for _, shard := range table.shards {
+		shard.SetBatchDataLoader(f)
+	}
+}
+
+// SetBatchDataLoaderContext configures a context-aware batch data-loader
+// callback, see CacheTable.SetBatchDataLoaderContext.
+func (table *ShardedTable) SetBatchDataLoaderContext(f func(ctx context.Context, keys []interface{}) (map[interface{}]*CacheItem, error)) {
+	for _, shard := range table.shards {
+		shard.SetBatchDataLoaderContext(f)
+	}
+}
+
+// SetBatchWindow configures how each shard's batch data-loader collects keys,
+// see CacheTable.SetBatchWindow.
+func (table *ShardedTable) SetBatchWindow(maxSize int, maxWait time.Duration) {
+	for _, shard := range table.shards {
+		shard.SetBatchWindow(maxSize, maxWait)
+	}
+}
+
+// SetRefreshAhead enables refresh-ahead, see CacheTable.SetRefreshAhead.
+func (table *ShardedTable) SetRefreshAhead(fraction float64) {
+	for _, shard := range table.shards {
+		shard.SetRefreshAhead(fraction)
+	}
+}
+
+// SetRefreshRetryInterval configures the minimum time between background
+// reloads of the same item, see CacheTable.SetRefreshRetryInterval.
+func (table *ShardedTable) SetRefreshRetryInterval(interval time.Duration) {
+	for _, shard := range table.shards {
+		shard.SetRefreshRetryInterval(interval)
+	}
+}
+
+// SetStaleGracePeriod enables serving stale items, see
+// CacheTable.SetStaleGracePeriod.
+func (table *ShardedTable) SetStaleGracePeriod(grace time.Duration) {
+	for _, shard := range table.shards {
+		shard.SetStaleGracePeriod(grace)
+	}
+}
+
+// SetCounterLifeSpan configures how counter operations treat the expiration
+// of existing counters, see WithCounterLifeSpan.
+func (table *ShardedTable) SetCounterLifeSpan(mode CounterLifeSpan) {
+	for _, shard := range table.shards {
+		shard.SetCounterLifeSpan(mode)
+	}
+}
+
+// SetNegativeLifeSpan enables negative caching, see
+// CacheTable.SetNegativeLifeSpan.
+func (table *ShardedTable) SetNegativeLifeSpan(lifeSpan time.Duration) {
+	for _, shard := range table.shards {
+		shard.SetNegativeLifeSpan(lifeSpan)
+	}
+}
+
+// SetAddedItemCallback configures a callback, which will be called every time
+// a new item is added to the cache.
+func (table *ShardedTable) SetAddedItemCallback(f func(*CacheItem)) {
+	for _, shard := range table.shards {
+		shard.SetAddedItemCallback(f)
+	}
+}
+
+// AddAddedItemCallback appends a new callback to the addedItem queue.
+func (table *ShardedTable) AddAddedItemCallback(f func(*CacheItem)) {
+	for _, shard := range table.shards {
+		shard.AddAddedItemCallback(f)
+	}
+}
+
+// RemoveAddedItemCallbacks empties the added item callback queue.
+func (table *ShardedTable) RemoveAddedItemCallbacks() {
+	for _, shard := range table.shards {
+		shard.RemoveAddedItemCallbacks()
+	}
+}
+
+// SetAboutToDeleteItemCallback configures a callback, which will be called
+// every time an item is about to be removed from the cache.
+func (table *ShardedTable) SetAboutToDeleteItemCallback(f func(*CacheItem)) {
+	for _, shard := range table.shards {
+		shard.SetAboutToDeleteItemCallback(f)
+	}
+}
+
+// AddAboutToDeleteItemCallback appends a new callback to the AboutToDeleteItem queue.
+func (table *ShardedTable) AddAboutToDeleteItemCallback(f func(*CacheItem)) {
+	for _, shard := range table.shards {
+		shard.AddAboutToDeleteItemCallback(f)
+	}
+}
+
+// RemoveAboutToDeleteItemCallback empties the about to delete item callback queue.
+func (table *ShardedTable) RemoveAboutToDeleteItemCallback() {
+	for _, shard := range table.shards {
+		shard.RemoveAboutToDeleteItemCallback()
+	}
+}
+
+// SetRemovedItemCallback configures a callback, which will be called every
+// time an item gets removed from the cache, along with the reason.
+func (table *ShardedTable) SetRemovedItemCallback(f func(*CacheItem, RemovalReason)) {
+	for _, shard := range table.shards {
+		shard.SetRemovedItemCallback(f)
+	}
+}
+
+// AddRemovedItemCallback appends a new callback to the removedItem queue.
+func (table *ShardedTable) AddRemovedItemCallback(f func(*CacheItem, RemovalReason)) {
+	for _, shard := range table.shards {
+		shard.AddRemovedItemCallback(f)
+	}
+}
+
+// RemoveRemovedItemCallbacks empties the removed item callback queue.
+func (table *ShardedTable) RemoveRemovedItemCallbacks() {
+	for _, shard := range table.shards {
+		shard.RemoveRemovedItemCallbacks()
+	}
+}
+
+// SetMaxEntries limits the table to roughly max items. The limit is split
+// evenly across all shards, so a shard may start evicting slightly before the
+// whole table is full.
+func (table *ShardedTable) SetMaxEntries(max int) {
+	perShard := 0
+	if max > 0 {
+		perShard = (max + len(table.shards) - 1) / len(table.shards)
+	}
+	for _, shard := range table.shards {
+		shard.SetMaxEntries(perShard)
+	}
+}
+
+// SetEvictionPolicy configures the policy used to pick items for eviction.
+// As every shard needs its own policy, it takes a constructor like
+// NewLRUPolicy rather than a policy instance.
+func (table *ShardedTable) SetEvictionPolicy(newPolicy func() EvictionPolicy) {
+	for _, shard := range table.shards {
+		shard.SetEvictionPolicy(newPolicy())
+	}
+}
+
+// SetLogger sets the logger to be used by this cache table.
+func (table *ShardedTable) SetLogger(logger *log.Logger) {
+	for _, shard := range table.shards {
+		shard.SetLogger(logger)
+	}
+}
+
+// Add adds a key/value pair to the cache.
+// Parameter key is the item's cache-key.
+// Parameter lifeSpan determines after which time period without an access the item
+// will get removed from the cache.
+// Parameter data is the item's value.
+func (table *ShardedTable) Add(key interface{}, lifeSpan time.Duration, data interface{}) *CacheItem {
+	return table.shard(key).Add(key, lifeSpan, data)
+}
+
+// AddWithOptions adds a key/value pair to the cache, expiring as configured by
+// opts.
+func (table *ShardedTable) AddWithOptions(key interface{}, data interface{}, opts ItemOptions) *CacheItem {
+	return table.shard(key).AddWithOptions(key, data, opts)
+}
+
+// AddWithDeadline adds a key/value pair to the cache, which gets removed once
+// it hasn't been accessed for lifeSpan or at the latest at deadline.
+func (table *ShardedTable) AddWithDeadline(key interface{}, lifeSpan time.Duration, deadline time.Time, data interface{}) *CacheItem {
+	return table.shard(key).AddWithDeadline(key, lifeSpan, deadline, data)
+}
+
+// ValueMulti returns the items stored for keys, in the same order, locking
+// each shard only once, see CacheTable.ValueMulti.
+func (table *ShardedTable) ValueMulti(keys ...interface{}) []Result {
+	return table.ValueMultiContext(context.Background(), keys...)
+}
+
+// ValueMultiContext is like ValueMulti, passing ctx on to the data-loader, see
+// CacheTable.ValueMultiContext.
+func (table *ShardedTable) ValueMultiContext(ctx context.Context, keys ...interface{}) []Result {
+	results := make([]Result, len(keys))
+	groups := table.group(keys)
+	var wg sync.WaitGroup
+	for shard, indexes := range groups {
+		wg.Add(1)
+		go func(shard *CacheTable, indexes []int) {
+			defer wg.Done()
+			for j, r := range shard.ValueMultiContext(ctx, pick(keys, indexes)...) {
+				results[indexes[j]] = r
+			}
+		}(shard, indexes)
+	}
+	wg.Wait()
+	return results
+}
+
+// AddMulti adds all entries to the cache, locking each shard only once. It
+// returns the added items in the same order, see CacheTable.AddMulti.
+func (table *ShardedTable) AddMulti(entries ...Entry) []*CacheItem {
+	items := make([]*CacheItem, len(entries))
+	keys := make([]interface{}, len(entries))
+	for i, e := range entries {
+		keys[i] = e.Key
+	}
+	for shard, indexes := range table.group(keys) {
+		batch := make([]Entry, len(indexes))
+		for j, i := range indexes {
+			batch[j] = entries[i]
+		}
+		for j, item := range shard.AddMulti(batch...) {
+			items[indexes[j]] = item
+		}
+	}
+	return items
+}
+
+// DeleteMulti deletes the items stored for keys from the cache, locking each
+// shard only once, see CacheTable.DeleteMulti.
+func (table *ShardedTable) DeleteMulti(keys ...interface{}) []Result {
+	results := make([]Result, len(keys))
+	for shard, indexes := range table.group(keys) {
+		for j, r := range shard.DeleteMulti(pick(keys, indexes)...) {
+			results[indexes[j]] = r
+		}
+	}
+	return results
+}
+
+// group returns the indexes of keys, grouped by the shard holding them.
+func (table *ShardedTable) group(keys []interface{}) map[*CacheTable][]int {
+	groups := make(map[*CacheTable][]int)
+	for i, key := range keys {
+		shard := table.shard(key)
+		groups[shard] = append(groups[shard], i)
+	}
+	return groups
+}
+
+// pick returns the keys at the given indexes.
+func pick(keys []interface{}, indexes []int) []interface{} {
+	picked := make([]interface{}, len(indexes))
+	for j, i := range indexes {
+		picked[j] = keys[i]
+	}
+	return picked
+}
+
+// Delete an item from the cache.
+func (table *ShardedTable) Delete(key interface{}) (*CacheItem, error) {
+	return table.shard(key).Delete(key)
+}
+
+// CompareAndSwap replaces the item stored for key, but only if the current item
+// has the given version, see CacheTable.CompareAndSwap. Each shard numbers its
+// items separately, so versions must only be compared for the same key.
+func (table *ShardedTable) CompareAndSwap(key interface{}, version uint64, lifeSpan time.Duration, data interface{}) (*CacheItem, error) {
+	return table.shard(key).CompareAndSwap(key, version, lifeSpan, data)
+}
+
+// CompareAndDelete deletes the item stored for key, but only if it has the
+// given version, see CacheTable.CompareAndDelete.
+func (table *ShardedTable) CompareAndDelete(key interface{}, version uint64) (*CacheItem, error) {
+	return table.shard(key).CompareAndDelete(key, version)
+}
+
+// Compute atomically updates the item stored for key, see CacheTable.Compute.
+func (table *ShardedTable) Compute(key interface{}, f func(old *CacheItem, exists bool) (newData interface{}, lifeSpan time.Duration, keep bool)) *CacheItem {
+	return table.shard(key).Compute(key, f)
+}
+
+// ComputeIfAbsent atomically adds an item for key, unless there is one
+// already, see CacheTable.ComputeIfAbsent.
+func (table *ShardedTable) ComputeIfAbsent(key interface{}, f func() (newData interface{}, lifeSpan time.Duration, keep bool)) *CacheItem {
+	return table.shard(key).ComputeIfAbsent(key, f)
+}
+
+// ComputeIfPresent atomically updates the item stored for key, if there is
+// one, see CacheTable.ComputeIfPresent.
+func (table *ShardedTable) ComputeIfPresent(key interface{}, f func(old *CacheItem) (newData interface{}, lifeSpan time.Duration, keep bool)) *CacheItem {
+	return table.shard(key).ComputeIfPresent(key, f)
+}
+
+// Increment atomically adds delta to the integer stored for key, see
+// CacheTable.Increment.
+func (table *ShardedTable) Increment(key interface{}, delta int64, lifeSpan time.Duration) (int64, error) {
+	return table.shard(key).Increment(key, delta, lifeSpan)
+}
+
+// Decrement atomically subtracts delta from the integer stored for key, see
+// CacheTable.Decrement.
+func (table *ShardedTable) Decrement(key interface{}, delta int64, lifeSpan time.Duration) (int64, error) {
+	return table.shard(key).Decrement(key, delta, lifeSpan)
+}
+
+// IncrementFloat atomically adds delta to the number stored for key, see
+// CacheTable.IncrementFloat.
+func (table *ShardedTable) IncrementFloat(key interface{}, delta float64, lifeSpan time.Duration) (float64, error) {
+	return table.shard(key).IncrementFloat(key, delta, lifeSpan)
+}
+
+// DecrementFloat atomically subtracts delta from the number stored for key,
+// see CacheTable.DecrementFloat.
+func (table *ShardedTable) DecrementFloat(key interface{}, delta float64, lifeSpan time.Duration) (float64, error) {
+	return table.shard(key).DecrementFloat(key, delta, lifeSpan)
+}
+
+// Touch sets the lifespan of the item stored for key and restarts it, without
+// replacing the item, see CacheTable.Touch.
+func (table *ShardedTable) Touch(key interface{}, lifeSpan time.Duration) (*CacheItem, error) {
+	return table.shard(key).Touch(key, lifeSpan)
+}
+
+// Exists returns whether an item exists in the cache. Unlike the Value method
+// Exists neither tries to fetch data via the loadData callback nor does it
+// keep the item alive in the cache.
+func (table *ShardedTable) Exists(key interface{}) bool {
+	return table.shard(key).Exists(key)
+}
+
+// Peek returns the item stored for key without any side effects, see
+// CacheTable.Peek.
+func (table *ShardedTable) Peek(key interface{}) (*CacheItem, error) {
+	return table.shard(key).Peek(key)
+}
+
+// NotFoundAdd checks whether an item is not yet cached. Unlike the Exists
+// method this also adds data if the key could not be found.
+func (table *ShardedTable) NotFoundAdd(key interface{}, lifeSpan time.Duration, data interface{}) bool {
+	return table.shard(key).NotFoundAdd(key, lifeSpan, data)
+}
+
+// Value returns an item from the cache and marks it to be kept alive. You can
+// pass additional arguments to your DataLoader callback function.
+func (table *ShardedTable) Value(key interface{}, args ...interface{}) (*CacheItem, error) {
+	return table.shard(key).Value(key, args...)
+}
+
+// ValueContext returns an item from the cache and marks it to be kept alive,
+// passing ctx on to the data-loader, see CacheTable.ValueContext.
+func (table *ShardedTable) ValueContext(ctx context.Context, key interface{}, args ...interface{}) (*CacheItem, error) {
+	return table.shard(key).ValueContext(ctx, key, args...)
+}
+
+// SetCodec configures the codec used by SaveTo and LoadFrom.
+func (table *ShardedTable) SetCodec(codec Codec) {
+	for _, shard := range table.shards {
+		shard.SetCodec(codec)
+	}
+}
+
+// SaveTo writes a snapshot of all items in this table to w. The snapshot does
+// not depend on the number of shards, it can be loaded into any table.
+func (table *ShardedTable) SaveTo(w io.Writer) error {
+	var items []snapshotItem
+	for _, shard := range table.shards {
+		items = append(items, shard.snapshot()...)
+	}
+	return writeSnapshot(table.codec(), w, table.name, items)
+}
+
+// LoadFrom adds all items from a snapshot read from r to this table, see
+// CacheTable.LoadFrom.
+func (table *ShardedTable) LoadFrom(r io.Reader) error {
+	// All shards share the clock they were created with.
+	_, err := readSnapshot(table.codec(), r, table.shards[0].clock.Now(), func(item *CacheItem) {
+		shard := table.shard(item.key)
+		shard.Lock()
+		shard.addInternal(item)
+	})
+	return err
+}
+
+// SaveFile writes a snapshot of all items in this table to the file at path,
+// see CacheTable.SaveFile.
+func (table *ShardedTable) SaveFile(path string) error {
+	return saveFile(path, table.SaveTo)
+}
+
+// LoadFile adds all items from the snapshot in the file at path to this table.
+func (table *ShardedTable) LoadFile(path string) error {
+	return loadFile(path, table.LoadFrom)
+}
+
+// codec returns the codec configured for all shards.
+func (table *ShardedTable) codec() Codec {
+	shard := table.shards[0]
+	shard.RLock()
+	defer shard.RUnlock()
+	return shard.codec
+}
+
+// Stats returns the current counters of this table, summed up over all shards.
+func (table *ShardedTable) Stats() TableStats {
+	var s TableStats
+	for _, shard := range table.shards {
+		s = s.add(shard.Stats())
+	}
+	return s
+}
+
+// LoaderLatency returns a histogram of how long data-loader calls took,
+// summed up over all shards.
+func (table *ShardedTable) LoaderLatency() LatencyHistogram {
+	var h LatencyHistogram
+	for _, shard := range table.shards {
+		h = h.add(shard.LoaderLatency())
+	}
+	return h
+}
+
+// ResetStats sets all counters of this table back to zero.
+func (table *ShardedTable) ResetStats() {
+	for _, shard := range table.shards {
+		shard.ResetStats()
+	}
+}
+
+// Flush deletes all items from this cache table.
+func (table *ShardedTable) Flush() {
+	for _, shard := range table.shards {
+		shard.Flush()
+	}
+}
+
+// MostAccessed returns the most accessed items in this cache table.
+func (table *ShardedTable) MostAccessed(count int64) []*CacheItem {
+	var r []*CacheItem
+	if count <= 0 {
+		return r
+	}
+	for _, shard := range table.shards {
+		r = append(r, shard.MostAccessed(count)...)
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].AccessCount() > r[j].AccessCount()
+	})
+	if int64(len(r)) > count {
+		r = r[:count]
+	}
+	return r
+}
@@ -0,0 +1,240 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotVersion is the version of the snapshot format written by SaveTo.
+const snapshotVersion = 1
+
+// ErrSnapshotVersion gets returned when trying to load a snapshot written in an
+// unknown format.
+var ErrSnapshotVersion = errors.New("Unsupported snapshot version")
+
+// Encoder writes values to a snapshot.
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder reads values from a snapshot.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// Codec serializes table snapshots. Keys and data of all items are passed to
+// the codec as interface{} values.
+type Codec interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+// GobCodec is the default Codec, using encoding/gob. Just like with any other
+// interface{} value sent via gob, the concrete types of keys and data have to
+// be registered with gob.Register, unless they are basic types.
+type GobCodec struct{}
+
+// NewEncoder returns a gob encoder writing to w.
+func (GobCodec) NewEncoder(w io.Writer) Encoder {
+	return gob.NewEncoder(w)
+}
+
+// NewDecoder returns a gob decoder reading from r.
+func (GobCodec) NewDecoder(r io.Reader) Decoder {
+	return gob.NewDecoder(r)
+}
+
+// snapshotHeader precedes the items in a snapshot.
+type snapshotHeader struct {
+	Version int
+	Table   string
+	Count   int
+}
+
+// snapshotItem is a single item in a snapshot.
+type snapshotItem struct {
+	Key         interface{}
+	Data        interface{}
+	LifeSpan    time.Duration
+	MaxAge      time.Duration
+	CreatedOn   time.Time
+	AccessedOn  time.Time
+	AccessCount int64
+}
+
+// SetCodec configures the codec used by SaveTo and LoadFrom.
+func (table *CacheTable) SetCodec(codec Codec) {
+	table.Lock()
+	defer table.Unlock()
+	table.codec = codec
+}
+
+// SaveTo writes a snapshot of all items in this table to w.
+func (table *CacheTable) SaveTo(w io.Writer) error {
+	table.RLock()
+	codec := table.codec
+	table.RUnlock()
+
+	items := table.snapshot()
+	if err := writeSnapshot(codec, w, table.name, items); err != nil {
+		return err
+	}
+	table.log("Saved", len(items), "items of table", table.name)
+	return nil
+}
+
+// LoadFrom adds all items from a snapshot read from r to this table. The items
+// keep their creation and access times, so they expire just as they would
+// have in the table they were saved from. Items which expired in the meantime
+// are skipped. Items already in the table get replaced.
+func (table *CacheTable) LoadFrom(r io.Reader) error {
+	table.RLock()
+	codec := table.codec
+	clock := table.clock
+	table.RUnlock()
+
+	loaded, err := readSnapshot(codec, r, clock.Now(), func(item *CacheItem) {
+		table.Lock()
+		table.addInternal(item)
+	})
+	table.log("Loaded", loaded, "items into table", table.name)
+	return err
+}
+
+// SaveFile writes a snapshot of all items in this table to the file at path.
+// The snapshot gets written to a temporary file first, which then replaces
+// the file at path, so a failed save never leaves a truncated snapshot behind.
+func (table *CacheTable) SaveFile(path string) error {
+	return saveFile(path, table.SaveTo)
+}
+
+// LoadFile adds all items from the snapshot in the file at path to this table.
+func (table *CacheTable) LoadFile(path string) error {
+	return loadFile(path, table.LoadFrom)
+}
+
+// snapshot returns a copy of all items in this table.
+func (table *CacheTable) snapshot() []snapshotItem {
+	table.RLock()
+	defer table.RUnlock()
+
+	items := make([]snapshotItem, 0, len(table.items))
+	for key, item := range table.items {
+		item.RLock()
+		items = append(items, snapshotItem{
+			Key:         key,
+			Data:        item.data,
+			LifeSpan:    item.lifeSpan,
+			MaxAge:      item.maxAge,
+			CreatedOn:   item.createdOn,
+			AccessedOn:  item.accessedOn,
+			AccessCount: item.accessCount,
+		})
+		item.RUnlock()
+	}
+	return items
+}
+
+// writeSnapshot encodes the items of table name to w.
+func writeSnapshot(codec Codec, w io.Writer, name string, items []snapshotItem) error {
+	if codec == nil {
+		codec = GobCodec{}
+	}
+	enc := codec.NewEncoder(w)
+	if err := enc.Encode(snapshotHeader{
+		Version: snapshotVersion,
+		Table:   name,
+		Count:   len(items),
+	}); err != nil {
+		return err
+	}
+	for i := range items {
+		if err := enc.Encode(&items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSnapshot decodes the items in a snapshot read from r and passes those
+// which haven't expired by now to add. It returns how many items were added.
+func readSnapshot(codec Codec, r io.Reader, now time.Time, add func(item *CacheItem)) (int, error) {
+	if codec == nil {
+		codec = GobCodec{}
+	}
+	dec := codec.NewDecoder(r)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return 0, err
+	}
+	if header.Version != snapshotVersion {
+		return 0, ErrSnapshotVersion
+	}
+
+	added := 0
+	for i := 0; i < header.Count; i++ {
+		var s snapshotItem
+		if err := dec.Decode(&s); err != nil {
+			return added, err
+		}
+
+		item := NewCacheItemWithOptions(s.Key, s.Data, ItemOptions{
+			LifeSpan: s.LifeSpan,
+			MaxAge:   s.MaxAge,
+		})
+		item.createdOn = s.CreatedOn
+		item.accessedOn = s.AccessedOn
+		item.accessCount = s.AccessCount
+		if deadline := item.deadline(); !deadline.IsZero() && !deadline.After(now) {
+			continue
+		}
+
+		add(item)
+		added++
+	}
+	return added, nil
+}
+
+// saveFile atomically replaces the file at path with what save writes.
+func saveFile(path string, save func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := save(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// loadFile passes the file at path to load.
+func loadFile(path string, load func(io.Reader) error) error {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return load(f)
+}
@@ -0,0 +1,64 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import "time"
+
+// SetStaleGracePeriod enables serving stale items: once an item expires, it
+// stays in the table for another grace period flagged as stale, see
+// CacheItem.IsStale. Value keeps returning a stale item while reloading it in
+// the background via the data-loader. If the data-loader fails, the stale
+// item keeps being served until the grace period is over, retrying the
+// data-loader at most once per refresh retry interval, see
+// SetRefreshRetryInterval. A grace period of 0, the default, removes items as
+// soon as they expire.
+// Stale items count as being in the table, e.g. for Exists and Count. Their
+// expiration callbacks run once they finally get removed.
+func (table *CacheTable) SetStaleGracePeriod(grace time.Duration) {
+	table.Lock()
+	defer table.Unlock()
+	table.staleGrace = grace
+}
+
+// WithStaleGracePeriod enables serving stale items, see
+// CacheTable.SetStaleGracePeriod.
+func WithStaleGracePeriod(grace time.Duration) TableOption {
+	return func(table *CacheTable) {
+		table.staleGrace = grace
+	}
+}
+
+// IsStale returns whether this item expired already and is only being served
+// during the table's stale grace period.
+func (item *CacheItem) IsStale() bool {
+	item.RLock()
+	defer item.RUnlock()
+	return item.stale
+}
+
+// markStale flags item as stale until the grace period after its deadline is
+// over.
+func (item *CacheItem) markStale(deadline time.Time, grace time.Duration) {
+	item.Lock()
+	defer item.Unlock()
+	item.stale = true
+	item.staleUntil = deadline.Add(grace)
+}
+
+// expiry returns when the table has to act on item next: at its deadline, or
+// at the end of the grace period once the item is stale. It returns the zero
+// time if the item never expires.
+func (item *CacheItem) expiry() time.Time {
+	item.RLock()
+	stale, staleUntil := item.stale, item.staleUntil
+	item.RUnlock()
+	if stale {
+		return staleUntil
+	}
+	return item.deadline()
+}
@@ -0,0 +1,192 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// loaderLatencyBuckets are the upper bounds of the loader latency histogram.
+var loaderLatencyBuckets = [...]time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// TableStats holds counters describing how a table has been used since it was
+// created or its stats were last reset.
+type TableStats struct {
+	// Hits counts Value calls which found the item in the table.
+	Hits uint64
+	// Misses counts Value calls which didn't find the item in the table.
+	Misses uint64
+	// LoaderCalls counts how often the data-loader was invoked.
+	LoaderCalls uint64
+	// LoaderFailures counts data-loader calls which didn't return an item,
+	// either because the key couldn't be found or because of an error.
+	LoaderFailures uint64
+	// Adds counts items added for keys which were not in the table yet.
+	Adds uint64
+	// Replaces counts items added for keys which were already in the table.
+	Replaces uint64
+	// Deletes counts items removed via Delete.
+	Deletes uint64
+	// Expirations counts items removed because they expired.
+	Expirations uint64
+	// Evictions counts items removed to make room for new ones.
+	Evictions uint64
+	// Flushes counts how often the table was flushed.
+	Flushes uint64
+}
+
+// HitRatio returns the share of Value calls which found the item in the table.
+func (s TableStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// add sums up s and o, e.g. for the shards of a ShardedTable.
+func (s TableStats) add(o TableStats) TableStats {
+	s.Hits += o.Hits
+	s.Misses += o.Misses
+	s.LoaderCalls += o.LoaderCalls
+	s.LoaderFailures += o.LoaderFailures
+	s.Adds += o.Adds
+	s.Replaces += o.Replaces
+	s.Deletes += o.Deletes
+	s.Expirations += o.Expirations
+	s.Evictions += o.Evictions
+	s.Flushes += o.Flushes
+	return s
+}
+
+// tableStats holds the counters of a table. They are only ever accessed
+// atomically, so updating them doesn't require holding the table-mutex.
+type tableStats struct {
+	hits           uint64
+	misses         uint64
+	loaderCalls    uint64
+	loaderFailures uint64
+	adds           uint64
+	replaces       uint64
+	deletes        uint64
+	expirations    uint64
+	evictions      uint64
+	flushes        uint64
+
+	// Loader latency histogram, the last bucket counts calls taking longer
+	// than the largest bound.
+	loaderLatency    [len(loaderLatencyBuckets) + 1]uint64
+	loaderLatencySum uint64
+}
+
+// LatencyHistogram describes how long data-loader calls took.
+type LatencyHistogram struct {
+	// Bounds are the upper bounds of the buckets, in increasing order.
+	Bounds []time.Duration
+	// Counts holds the number of calls per bucket. It has one more element
+	// than Bounds, counting the calls exceeding the largest bound.
+	Counts []uint64
+	// Sum is the total time spent in data-loader calls.
+	Sum time.Duration
+}
+
+// Count returns the number of calls in the histogram.
+func (h LatencyHistogram) Count() uint64 {
+	var n uint64
+	for _, c := range h.Counts {
+		n += c
+	}
+	return n
+}
+
+// add sums up h and o, which need to have the same bounds.
+func (h LatencyHistogram) add(o LatencyHistogram) LatencyHistogram {
+	r := LatencyHistogram{
+		Bounds: o.Bounds,
+		Counts: make([]uint64, len(o.Counts)),
+		Sum:    h.Sum + o.Sum,
+	}
+	copy(r.Counts, o.Counts)
+	for i := range h.Counts {
+		r.Counts[i] += h.Counts[i]
+	}
+	return r
+}
+
+// observeLoaderLatency records a data-loader call which took d.
+func (s *tableStats) observeLoaderLatency(d time.Duration) {
+	i := 0
+	for i < len(loaderLatencyBuckets) && d > loaderLatencyBuckets[i] {
+		i++
+	}
+	atomic.AddUint64(&s.loaderLatency[i], 1)
+	atomic.AddUint64(&s.loaderLatencySum, uint64(d))
+}
+
+// inc atomically increments counter.
+func inc(counter *uint64) {
+	atomic.AddUint64(counter, 1)
+}
+
+// Stats returns the current counters of this table.
+func (table *CacheTable) Stats() TableStats {
+	s := table.stats
+	return TableStats{
+		Hits:           atomic.LoadUint64(&s.hits),
+		Misses:         atomic.LoadUint64(&s.misses),
+		LoaderCalls:    atomic.LoadUint64(&s.loaderCalls),
+		LoaderFailures: atomic.LoadUint64(&s.loaderFailures),
+		Adds:           atomic.LoadUint64(&s.adds),
+		Replaces:       atomic.LoadUint64(&s.replaces),
+		Deletes:        atomic.LoadUint64(&s.deletes),
+		Expirations:    atomic.LoadUint64(&s.expirations),
+		Evictions:      atomic.LoadUint64(&s.evictions),
+		Flushes:        atomic.LoadUint64(&s.flushes),
+	}
+}
+
+// ResetStats sets all counters of this table back to zero.
+func (table *CacheTable) ResetStats() {
+	s := table.stats
+	for _, counter := range []*uint64{
+		&s.hits, &s.misses, &s.loaderCalls, &s.loaderFailures, &s.adds,
+		&s.replaces, &s.deletes, &s.expirations, &s.evictions, &s.flushes,
+	} {
+		atomic.StoreUint64(counter, 0)
+	}
+	for i := range s.loaderLatency {
+		atomic.StoreUint64(&s.loaderLatency[i], 0)
+	}
+	atomic.StoreUint64(&s.loaderLatencySum, 0)
+}
+
+// LoaderLatency returns a histogram of how long data-loader calls took.
+func (table *CacheTable) LoaderLatency() LatencyHistogram {
+	s := table.stats
+	h := LatencyHistogram{
+		Bounds: loaderLatencyBuckets[:],
+		Counts: make([]uint64, len(s.loaderLatency)),
+		Sum:    time.Duration(atomic.LoadUint64(&s.loaderLatencySum)),
+	}
+	for i := range s.loaderLatency {
+		h.Counts[i] = atomic.LoadUint64(&s.loaderLatency[i])
+	}
+	return h
+}
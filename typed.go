@@ -0,0 +1,375 @@
+/*
+ * Simple caching library with expiration capabilities
+ *     Copyright (c) 2013-2017, Christian Muehlhaeuser <muesli@gmail.com>
+ *
+ *   For license see LICENSE.txt
+ */
+
+package cache2go
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+)
+
+// Item is a type-safe view on a CacheItem with keys of type K and values of
+// type V. All untyped accessors like LifeSpan or AccessCount are available
+// through the embedded CacheItem.
+type Item[K comparable, V any] struct {
+	*CacheItem
+}
+
+// NewItem returns a newly created Item, e.g. to be returned by a data-loader.
+// See NewCacheItem for the meaning of its parameters.
+func NewItem[K comparable, V any](key K, lifeSpan time.Duration, data V) *Item[K, V] {
+	return &Item[K, V]{NewCacheItem(key, lifeSpan, data)}
+}
+
+// wrapItem returns a typed view on item, or nil if item is nil.
+func wrapItem[K comparable, V any](item *CacheItem) *Item[K, V] {
+	if item == nil {
+		return nil
+	}
+	return &Item[K, V]{item}
+}
+
+// Key returns the key of this cached item.
+func (item *Item[K, V]) Key() K {
+	k, _ := item.CacheItem.Key().(K)
+	return k
+}
+
+// Data returns the value of this cached item.
+func (item *Item[K, V]) Data() V {
+	d, _ := item.CacheItem.Data().(V)
+	return d
+}
+
+// SetAboutToExpireCallback configures a callback, which will be called right
+// before the item is about to be removed from the cache.
+func (item *Item[K, V]) SetAboutToExpireCallback(f func(K)) {
+	item.CacheItem.SetAboutToExpireCallback(func(key interface{}) {
+		k, _ := key.(K)
+		f(k)
+	})
+}
+
+// AddAboutToExpireCallback appends a new callback to the AboutToExpire queue.
+func (item *Item[K, V]) AddAboutToExpireCallback(f func(K)) {
+	item.CacheItem.AddAboutToExpireCallback(func(key interface{}) {
+		k, _ := key.(K)
+		f(k)
+	})
+}
+
+// SetRemovedCallback configures a callback, which will be called when the
+// item gets removed from the cache, along with the reason.
+func (item *Item[K, V]) SetRemovedCallback(f func(K, RemovalReason)) {
+	item.CacheItem.SetRemovedCallback(func(key interface{}, reason RemovalReason) {
+		k, _ := key.(K)
+		f(k, reason)
+	})
+}
+
+// AddRemovedCallback appends a new callback to the removed queue.
+func (item *Item[K, V]) AddRemovedCallback(f func(K, RemovalReason)) {
+	item.CacheItem.AddRemovedCallback(func(key interface{}, reason RemovalReason) {
+		k, _ := key.(K)
+		f(k, reason)
+	})
+}
+
+// TypedTable is a type-safe view on a CacheTable, storing keys of type K and
+// values of type V. It shares all items, callbacks and settings with the
+// underlying CacheTable, so both APIs can be used side by side as long as
+// the untyped one sticks to the same key and value types.
+type TypedTable[K comparable, V any] struct {
+	table *CacheTable
+}
+
+// Typed returns a type-safe view on the existing cache table with given name
+// or creates a new one if the table does not exist yet. The options only get
+// applied when creating the table.
+func Typed[K comparable, V any](table string, opts ...TableOption) *TypedTable[K, V] {
+	return NewTypedTable[K, V](Cache(table, opts...))
+}
+
+// NewTypedTable returns a type-safe view on table.
+func NewTypedTable[K comparable, V any](table *CacheTable) *TypedTable[K, V] {
+	return &TypedTable[K, V]{table: table}
+}
+
+// Table returns the underlying untyped CacheTable.
+func (t *TypedTable[K, V]) Table() *CacheTable {
+	return t.table
+}
+
+// Count returns how many items are currently stored in the cache.
+func (t *TypedTable[K, V]) Count() int {
+	return t.table.Count()
+}
+
+// Foreach all items. Items whose key is not of type K are skipped.
+func (t *TypedTable[K, V]) Foreach(trans func(key K, item *Item[K, V])) {
+	t.table.Foreach(func(key interface{}, item *CacheItem) {
+		if k, ok := key.(K); ok {
+			trans(k, wrapItem[K, V](item))
+		}
+	})
+}
+
+// SetDataLoader configures a data-loader callback, which will be called when
+// trying to access a non-existing key. The key and 0...n additional arguments
+// are passed to the callback function.
+func (t *TypedTable[K, V]) SetDataLoader(f func(K, ...interface{}) *Item[K, V]) {
+	t.table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		k, _ := key.(K)
+		item := f(k, args...)
+		if item == nil {
+			return nil
+		}
+		return item.CacheItem
+	})
+}
+
+// SetDataLoaderContext configures a context-aware data-loader callback, see
+// CacheTable.SetDataLoaderContext.
+func (t *TypedTable[K, V]) SetDataLoaderContext(f func(context.Context, K, ...interface{}) (*Item[K, V], error)) {
+	t.table.SetDataLoaderContext(func(ctx context.Context, key interface{}, args ...interface{}) (*CacheItem, error) {
+		k, _ := key.(K)
+		item, err := f(ctx, k, args...)
+		if item == nil {
+			return nil, err
+		}
+		return item.CacheItem, err
+	})
+}
+
+// SetNegativeLifeSpan enables negative caching, see
+// CacheTable.SetNegativeLifeSpan.
+func (t *TypedTable[K, V]) SetNegativeLifeSpan(lifeSpan time.Duration) {
+	t.table.SetNegativeLifeSpan(lifeSpan)
+}
+
+// SetRefreshAhead enables refresh-ahead, see CacheTable.SetRefreshAhead.
+func (t *TypedTable[K, V]) SetRefreshAhead(fraction float64) {
+	t.table.SetRefreshAhead(fraction)
+}
+
+// SetStaleGracePeriod enables serving stale items, see
+// CacheTable.SetStaleGracePeriod.
+func (t *TypedTable[K, V]) SetStaleGracePeriod(grace time.Duration) {
+	t.table.SetStaleGracePeriod(grace)
+}
+
+// SetAddedItemCallback configures a callback, which will be called every time
+// a new item is added to the cache.
+func (t *TypedTable[K, V]) SetAddedItemCallback(f func(*Item[K, V])) {
+	t.table.SetAddedItemCallback(typedCallback(f))
+}
+
+// AddAddedItemCallback appends a new callback to the addedItem queue.
+func (t *TypedTable[K, V]) AddAddedItemCallback(f func(*Item[K, V])) {
+	t.table.AddAddedItemCallback(typedCallback(f))
+}
+
+// RemoveAddedItemCallbacks empties the added item callback queue.
+func (t *TypedTable[K, V]) RemoveAddedItemCallbacks() {
+	t.table.RemoveAddedItemCallbacks()
+}
+
+// SetAboutToDeleteItemCallback configures a callback, which will be called
+// every time an item is about to be removed from the cache.
+func (t *TypedTable[K, V]) SetAboutToDeleteItemCallback(f func(*Item[K, V])) {
+	t.table.SetAboutToDeleteItemCallback(typedCallback(f))
+}
+
+// AddAboutToDeleteItemCallback appends a new callback to the AboutToDeleteItem queue.
+func (t *TypedTable[K, V]) AddAboutToDeleteItemCallback(f func(*Item[K, V])) {
+	t.table.AddAboutToDeleteItemCallback(typedCallback(f))
+}
+
+// RemoveAboutToDeleteItemCallback empties the about to delete item callback queue.
+func (t *TypedTable[K, V]) RemoveAboutToDeleteItemCallback() {
+	t.table.RemoveAboutToDeleteItemCallback()
+}
+
+// SetRemovedItemCallback configures a callback, which will be called every
+// time an item gets removed from the cache, along with the reason.
+func (t *TypedTable[K, V]) SetRemovedItemCallback(f func(*Item[K, V], RemovalReason)) {
+	t.table.SetRemovedItemCallback(typedRemovedCallback(f))
+}
+
+// AddRemovedItemCallback appends a new callback to the removedItem queue.
+func (t *TypedTable[K, V]) AddRemovedItemCallback(f func(*Item[K, V], RemovalReason)) {
+	t.table.AddRemovedItemCallback(typedRemovedCallback(f))
+}
+
+// RemoveRemovedItemCallbacks empties the removed item callback queue.
+func (t *TypedTable[K, V]) RemoveRemovedItemCallbacks() {
+	t.table.RemoveRemovedItemCallbacks()
+}
+
+// typedRemovedCallback adapts a typed removal callback to the untyped table API.
+func typedRemovedCallback[K comparable, V any](f func(*Item[K, V], RemovalReason)) func(*CacheItem, RemovalReason) {
+	return func(item *CacheItem, reason RemovalReason) {
+		f(wrapItem[K, V](item), reason)
+	}
+}
+
+// typedCallback adapts a typed item callback to the untyped table API.
+func typedCallback[K comparable, V any](f func(*Item[K, V])) func(*CacheItem) {
+	return func(item *CacheItem) {
+		f(wrapItem[K, V](item))
+	}
+}
+
+// SetMaxEntries limits the table to max items, see CacheTable.SetMaxEntries.
+func (t *TypedTable[K, V]) SetMaxEntries(max int) {
+	t.table.SetMaxEntries(max)
+}
+
+// SetEvictionPolicy configures the policy used to pick items for eviction.
+func (t *TypedTable[K, V]) SetEvictionPolicy(policy EvictionPolicy) {
+	t.table.SetEvictionPolicy(policy)
+}
+
+// SetLogger sets the logger to be used by this cache table.
+func (t *TypedTable[K, V]) SetLogger(logger *log.Logger) {
+	t.table.SetLogger(logger)
+}
+
+// Add adds a key/value pair to the cache.
+// Parameter key is the item's cache-key.
+// Parameter lifeSpan determines after which time period without an access the item
+// will get removed from the cache.
+// Parameter data is the item's value.
+func (t *TypedTable[K, V]) Add(key K, lifeSpan time.Duration, data V) *Item[K, V] {
+	return wrapItem[K, V](t.table.Add(key, lifeSpan, data))
+}
+
+// AddWithOptions adds a key/value pair to the cache, expiring as configured by
+// opts.
+func (t *TypedTable[K, V]) AddWithOptions(key K, data V, opts ItemOptions) *Item[K, V] {
+	return wrapItem[K, V](t.table.AddWithOptions(key, data, opts))
+}
+
+// AddWithDeadline adds a key/value pair to the cache, which gets removed once
+// it hasn't been accessed for lifeSpan or at the latest at deadline.
+func (t *TypedTable[K, V]) AddWithDeadline(key K, lifeSpan time.Duration, deadline time.Time, data V) *Item[K, V] {
+	return wrapItem[K, V](t.table.AddWithDeadline(key, lifeSpan, deadline, data))
+}
+
+// Delete an item from the cache.
+func (t *TypedTable[K, V]) Delete(key K) (*Item[K, V], error) {
+	item, err := t.table.Delete(key)
+	return wrapItem[K, V](item), err
+}
+
+// CompareAndSwap replaces the item stored for key, but only if the current item
+// has the given version, see CacheTable.CompareAndSwap.
+func (t *TypedTable[K, V]) CompareAndSwap(key K, version uint64, lifeSpan time.Duration, data V) (*Item[K, V], error) {
+	item, err := t.table.CompareAndSwap(key, version, lifeSpan, data)
+	return wrapItem[K, V](item), err
+}
+
+// CompareAndDelete deletes the item stored for key, but only if it has the
+// given version, see CacheTable.CompareAndDelete.
+func (t *TypedTable[K, V]) CompareAndDelete(key K, version uint64) (*Item[K, V], error) {
+	item, err := t.table.CompareAndDelete(key, version)
+	return wrapItem[K, V](item), err
+}
+
+// Compute atomically updates the item stored for key, see CacheTable.Compute.
+func (t *TypedTable[K, V]) Compute(key K, f func(old *Item[K, V], exists bool) (newData V, lifeSpan time.Duration, keep bool)) *Item[K, V] {
+	return wrapItem[K, V](t.table.Compute(key, func(old *CacheItem, exists bool) (interface{}, time.Duration, bool) {
+		return f(wrapItem[K, V](old), exists)
+	}))
+}
+
+// ComputeIfAbsent atomically adds an item for key, unless there is one
+// already, see CacheTable.ComputeIfAbsent.
+func (t *TypedTable[K, V]) ComputeIfAbsent(key K, f func() (newData V, lifeSpan time.Duration, keep bool)) *Item[K, V] {
+	return wrapItem[K, V](t.table.ComputeIfAbsent(key, func() (interface{}, time.Duration, bool) {
+		return f()
+	}))
+}
+
+// ComputeIfPresent atomically updates the item stored for key, if there is
+// one, see CacheTable.ComputeIfPresent.
+func (t *TypedTable[K, V]) ComputeIfPresent(key K, f func(old *Item[K, V]) (newData V, lifeSpan time.Duration, keep bool)) *Item[K, V] {
+	return wrapItem[K, V](t.table.ComputeIfPresent(key, func(old *CacheItem) (interface{}, time.Duration, bool) {
+		return f(wrapItem[K, V](old))
+	}))
+}
+
+// Exists returns whether an item exists in the cache. Unlike the Value method
+// Exists neither tries to fetch data via the loadData callback nor does it
+// keep the item alive in the cache.
+func (t *TypedTable[K, V]) Exists(key K) bool {
+	return t.table.Exists(key)
+}
+
+// NotFoundAdd checks whether an item is not yet cached. Unlike the Exists
+// method this also adds data if the key could not be found.
+func (t *TypedTable[K, V]) NotFoundAdd(key K, lifeSpan time.Duration, data V) bool {
+	return t.table.NotFoundAdd(key, lifeSpan, data)
+}
+
+// Value returns an item from the cache and marks it to be kept alive. You can
+// pass additional arguments to your DataLoader callback function.
+func (t *TypedTable[K, V]) Value(key K, args ...interface{}) (*Item[K, V], error) {
+	item, err := t.table.Value(key, args...)
+	return wrapItem[K, V](item), err
+}
+
+// ValueContext returns an item from the cache and marks it to be kept alive,
+// passing ctx on to the data-loader, see CacheTable.ValueContext.
+func (t *TypedTable[K, V]) ValueContext(ctx context.Context, key K, args ...interface{}) (*Item[K, V], error) {
+	item, err := t.table.ValueContext(ctx, key, args...)
+	return wrapItem[K, V](item), err
+}
+
+// Peek returns the item stored for key without any side effects, see
+// CacheTable.Peek.
+func (t *TypedTable[K, V]) Peek(key K) (*Item[K, V], error) {
+	item, err := t.table.Peek(key)
+	return wrapItem[K, V](item), err
+}
+
+// SaveTo writes a snapshot of all items in this table to w.
+func (t *TypedTable[K, V]) SaveTo(w io.Writer) error {
+	return t.table.SaveTo(w)
+}
+
+// LoadFrom adds all items from a snapshot read from r to this table.
+func (t *TypedTable[K, V]) LoadFrom(r io.Reader) error {
+	return t.table.LoadFrom(r)
+}
+
+// Stats returns the current counters of this table.
+func (t *TypedTable[K, V]) Stats() TableStats {
+	return t.table.Stats()
+}
+
+// ResetStats sets all counters of this table back to zero.
+func (t *TypedTable[K, V]) ResetStats() {
+	t.table.ResetStats()
+}
+
+// Flush deletes all items from this cache table.
+func (t *TypedTable[K, V]) Flush() {
+	t.table.Flush()
+}
+
+// MostAccessed returns the most accessed items in this cache table.
+func (t *TypedTable[K, V]) MostAccessed(count int64) []*Item[K, V] {
+	items := t.table.MostAccessed(count)
+	r := make([]*Item[K, V], 0, len(items))
+	for _, item := range items {
+		r = append(r, wrapItem[K, V](item))
+	}
+	return r
+}